@@ -7,7 +7,7 @@ import (
 	"net/http"
 	"os"
 
-	_ "github.com/et-hicks/imitation-backend/src"
+	api "github.com/et-hicks/imitation-backend/src"
 )
 
 //go:embed templates/*
@@ -22,7 +22,8 @@ func main() {
 
 	}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	// The index page is only at the root; other unknown paths are 404s
+	http.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
 		data := map[string]string{
 			"Region": os.Getenv("FLY_REGION"),
 		}
@@ -30,7 +31,7 @@ func main() {
 		t.ExecuteTemplate(w, "index.html.tmpl", data)
 	})
 
-	http.HandleFunc("/about", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("GET /about", func(w http.ResponseWriter, r *http.Request) {
 		data := map[string]string{
 			"Region": os.Getenv("FLY_REGION"),
 		}
@@ -39,7 +40,7 @@ func main() {
 	})
 
 	// Serve JSON data from embedded file
-	http.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("GET /data", func(w http.ResponseWriter, r *http.Request) {
 		content, err := resources.ReadFile("data/data.json")
 		if err != nil {
 			http.Error(w, "failed to read data", http.StatusInternalServerError)
@@ -65,5 +66,5 @@ func main() {
 	}
 
 	log.Println("listening on", port)
-	log.Fatal(http.ListenAndServe(":"+port, cors(http.DefaultServeMux)))
+	log.Fatal(http.ListenAndServe(":"+port, cors(api.Authenticate(http.DefaultServeMux))))
 }
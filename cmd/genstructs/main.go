@@ -12,8 +12,9 @@ import (
 )
 
 type Column struct {
-	Name string
-	Type string
+	Name     string
+	Type     string
+	Nullable bool
 }
 
 type Table struct {
@@ -21,12 +22,23 @@ type Table struct {
 	Columns []Column
 }
 
+// generatedTables are the tables models.go holds; the others have
+// hand-written types elsewhere in models.
+var generatedTables = map[string]bool{"users": true, "tweets": true, "comments": true}
+
+// main regenerates models/models.go from sql/schema.sql. Run it from the
+// module root.
 func main() {
-	schema, err := os.ReadFile("schema.sql")
+	schema, err := os.ReadFile("sql/schema.sql")
 	if err != nil {
 		panic(err)
 	}
-	tables := parseSchema(string(schema))
+	var tables []Table
+	for _, t := range parseSchema(string(schema)) {
+		if generatedTables[t.Name] {
+			tables = append(tables, t)
+		}
+	}
 	if err := writeStructs("models/models.go", tables); err != nil {
 		panic(err)
 	}
@@ -64,7 +76,9 @@ func parseSchema(s string) []Table {
 		if colName == "PRIMARY" || colName == "FOREIGN" || colName == "UNIQUE" {
 			continue
 		}
-		tbl.Columns = append(tbl.Columns, Column{Name: colName, Type: colType})
+		upper := strings.ToUpper(line)
+		nullable := !strings.Contains(upper, "NOT NULL") && !strings.Contains(upper, "PRIMARY KEY")
+		tbl.Columns = append(tbl.Columns, Column{Name: colName, Type: colType, Nullable: nullable})
 	}
 	return tables
 }
@@ -80,7 +94,7 @@ func writeStructs(filename string, tables []Table) error {
 		typeName := toCamel(singularize(t.Name))
 		buf.WriteString(fmt.Sprintf("type %s struct {\n", typeName))
 		for _, c := range t.Columns {
-			buf.WriteString(fmt.Sprintf("\t%s %s `json:\"%s\"`\n", toCamel(c.Name), sqlTypeToGo(c.Type), c.Name))
+			buf.WriteString(fmt.Sprintf("\t%s %s `json:\"%s\"`\n", toCamel(c.Name), goType(c), c.Name))
 		}
 		buf.WriteString("}\n\n")
 	}
@@ -105,6 +119,17 @@ func usesTime(tables []Table) bool {
 	return false
 }
 
+// goType is the field type for c. Nullable integers, such as optional
+// references, become pointers so that NULL is told apart from 0; other
+// nullable columns use their zero value.
+func goType(c Column) string {
+	t := sqlTypeToGo(c.Type)
+	if c.Nullable && t == "int" {
+		return "*int"
+	}
+	return t
+}
+
 func sqlTypeToGo(s string) string {
 	s = strings.ToUpper(s)
 	switch s {
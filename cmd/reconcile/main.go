@@ -0,0 +1,27 @@
+// Command reconcile recomputes the like, save, restack, comment and reply
+// counters on tweets and comments from user_tweet_interactions and comments.
+// It uses the same STORE_BACKEND configuration as the server.
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	api "github.com/et-hicks/imitation-backend/src"
+)
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	st, err := api.GetStore(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	changed, err := st.ReconcileCounters(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("reconciled counters on %d rows", changed)
+}
@@ -1,12 +1,24 @@
 #!/usr/bin/env bash
 
+# To run the server offline against the in-memory store:
+#   STORE_BACKEND=memory \
+#   MEMORY_SEED=sql/users.sql,sql/tweets.sql,sql/comments.sql,sql/dev_sessions.sql \
+#   go run .
+# and use token="dev-session-<user_id>".
+# MAX_BODY_LENGTH (default 280) and MAX_BIO_LENGTH (default 160) set how many
+# characters tweet and comment bodies and bios may have.
+
 # Base URL of the server
 BASE_URL="${BASE_URL:-http://localhost:8080}"
 
 # Sample IDs used in requests; replace as needed
+# token is a SUPABASE_JWT_SECRET-signed JWT or a next_auth sessionToken for user_id
+token="replace-with-session-token"
 user_id="123"
 tweet_id="1"
+comment_id="1"
 follow_id="456"
+folder_id="1"
 
 # --------------------
 # Root endpoints
@@ -23,61 +35,173 @@ curl -X GET "$BASE_URL/data"
 
 # --------------------
 # API endpoints
+# Each route below also answers at its old path, without the /v1 prefix
 # --------------------
 
-# Home timeline
-curl -X GET "$BASE_URL/home"
+# Home timeline (newest tweets from everyone)
+curl -X GET "$BASE_URL/v1/home?mode=latest"
+
+# Following timeline: tweets and restacks from accounts you follow
+curl -X GET "$BASE_URL/v1/home?mode=following" \
+  -H "Authorization: Bearer $token"
 
 # Fetch a specific tweet
-curl -X GET "$BASE_URL/tweet/$tweet_id"
+curl -X GET "$BASE_URL/v1/tweet/$tweet_id"
 
-# Fetch comments for a tweet
-curl -X GET "$BASE_URL/tweet/$tweet_id/comments"
+# Fetch the top-level comments for a tweet
+curl -X GET "$BASE_URL/v1/tweet/$tweet_id/comments"
 
 # Create a new tweet
 # Replace {user_id} and the body content as needed
-curl -X POST "$BASE_URL/tweet" \
+curl -X POST "$BASE_URL/v1/tweet" \
   -H "Content-Type: application/json" \
-  -H "Authorization: $user_id" \
+  -H "Authorization: Bearer $token" \
   -d '{"body": "Hello world", "is_comment": false}'
 
 # Create a comment on a tweet
-curl -X POST "$BASE_URL/tweet" \
+curl -X POST "$BASE_URL/v1/tweet" \
   -H "Content-Type: application/json" \
-  -H "Authorization: $user_id" \
+  -H "Authorization: Bearer $token" \
   -H "Parent-Tweet-ID: $tweet_id" \
   -d '{"body": "Nice post!", "is_comment": true}'
 
-# Get the latest tweets for a user
-curl -X GET "$BASE_URL/user/$user_id"
+# Edit a tweet you wrote
+curl -X PATCH "$BASE_URL/v1/tweet/$tweet_id" \
+  -H "Content-Type: application/json" \
+  -H "Authorization: Bearer $token" \
+  -d '{"body": "Hello again, world"}'
+
+# Edit a comment you wrote (the id is the comment id)
+curl -X PATCH "$BASE_URL/v1/tweet/$comment_id" \
+  -H "Content-Type: application/json" \
+  -H "Authorization: Bearer $token" \
+  -H "Is-Comment: true" \
+  -d '{"body": "Nicer post!"}'
+
+# Delete a tweet you wrote, with its comments and interactions
+# (add -H "Is-Comment: true" and a comment id to delete a comment)
+curl -X DELETE "$BASE_URL/v1/tweet/$tweet_id" \
+  -H "Authorization: Bearer $token"
+
+# Prior versions of an edited tweet (add -H "Is-Comment: true" for a comment)
+curl -X GET "$BASE_URL/v1/tweet/$tweet_id/history"
+
+# Users who liked or restacked a tweet, most recent first
+curl -X GET "$BASE_URL/v1/tweet/$tweet_id/likes"
+curl -X GET "$BASE_URL/v1/tweet/$tweet_id/restacks"
+
+# Users who liked a comment
+curl -X GET "$BASE_URL/v1/comment/$comment_id/likes"
+
+# Reply to a comment; the reply joins the parent comment's tweet
+curl -X POST "$BASE_URL/v1/tweet" \
+  -H "Content-Type: application/json" \
+  -H "Authorization: Bearer $token" \
+  -H "Parent-Comment-ID: $comment_id" \
+  -d '{"body": "Agreed!", "is_comment": true}'
+
+# A comment with its replies nested up to depth levels (1-10, default 3)
+curl -X GET "$BASE_URL/v1/comment/$comment_id/replies?depth=3"
+
+# Search tweets, comments and users. q takes words, "quoted phrases" and the
+# operators from:username, before:YYYY-MM-DD, after:YYYY-MM-DD and has:replies;
+# type=tweets|comments|users narrows it, and limit/offset page through it
+curl -G "$BASE_URL/v1/search" \
+  --data-urlencode 'q="machine learning" from:ana_sky after:2023-01-01' \
+  --data-urlencode 'type=tweets'
+
+# Tweets tagged with a hashtag, newest first; the leading # is optional
+curl -X GET "$BASE_URL/v1/hashtag/golang"
+
+# The caller's notifications, most recently updated first, with their unread
+# count; then mark some read, or all of them when ids is left out
+curl -X GET "$BASE_URL/v1/notifications" \
+  -H "Authorization: Bearer $token"
+curl -X POST "$BASE_URL/v1/notifications/read" \
+  -H "Content-Type: application/json" \
+  -H "Authorization: Bearer $token" \
+  -d '{"ids": [1, 2]}'
+
+# Stream new tweets, comments, comment counts and interactions as Server-Sent
+# Events; Last-Event-ID resumes after the last event seen
+curl -N "$BASE_URL/v1/events" \
+  -H "Authorization: Bearer $token" \
+  -H "Last-Event-ID: 42"
+
+# Follow tweets and users over a WebSocket (curl cannot speak it; websocat can),
+# then send {"action": "subscribe", "tweet_ids": [1], "user_ids": [2]}
+websocat "${BASE_URL/http/ws}/v1/ws" -H "Authorization: Bearer $token"
+# Browsers cannot set headers on a WebSocket; pass the token in the URL instead
+websocat "${BASE_URL/http/ws}/v1/ws?access_token=$token"
+
+# Get a user's profile, with follower/following counts, and their tweets and restacks
+curl -X GET "$BASE_URL/v1/user/$user_id"
+
+# List a user's followers and the users they follow
+curl -X GET "$BASE_URL/v1/user/$user_id/followers"
+curl -X GET "$BASE_URL/v1/user/$user_id/following"
+
+# List the tweets and comments a user liked, most recently liked first
+curl -X GET "$BASE_URL/v1/user/$user_id/likes"
+
+# List the tweets and comments that mention a user, most recent first
+curl -X GET "$BASE_URL/v1/user/$user_id/mentions"
 
 # Update a user's bio
-curl -X POST "$BASE_URL/user/$user_id/bio" \
+curl -X POST "$BASE_URL/v1/user/$user_id/bio" \
   -H "Content-Type: application/json" \
+  -H "Authorization: Bearer $token" \
   -d '{"bio": "New bio"}'
 
 # Like a tweet
-curl -X PUT "$BASE_URL/like/$user_id/$tweet_id" \
-  -H "Authorization: $user_id" \
+curl -X PUT "$BASE_URL/v1/like/$user_id/$tweet_id" \
+  -H "Authorization: Bearer $token" \
   -H "Is-Comment: false"
 
 # Remove like from a tweet
-curl -X PUT "$BASE_URL/like/$user_id/$tweet_id?remove=true" \
-  -H "Authorization: $user_id" \
+curl -X PUT "$BASE_URL/v1/like/$user_id/$tweet_id?remove=true" \
+  -H "Authorization: Bearer $token" \
   -H "Is-Comment: false"
 
 # Save a tweet
-curl -X PUT "$BASE_URL/save/$user_id/$tweet_id" \
-  -H "Authorization: $user_id"
+curl -X PUT "$BASE_URL/v1/save/$user_id/$tweet_id" \
+  -H "Authorization: Bearer $token"
 
 # Remove a saved tweet
-curl -X PUT "$BASE_URL/save/$user_id/$tweet_id?remove=true" \
-  -H "Authorization: $user_id"
+curl -X PUT "$BASE_URL/v1/save/$user_id/$tweet_id?remove=true" \
+  -H "Authorization: Bearer $token"
+
+# Save a tweet into one of your bookmark folders (folder=none unfiles it)
+curl -X PUT "$BASE_URL/v1/save/$user_id/$tweet_id?folder=$folder_id" \
+  -H "Authorization: Bearer $token"
+
+# List the tweets you saved, most recently saved first (add ?folder=$folder_id
+# to list one folder)
+curl -X GET "$BASE_URL/v1/user/$user_id/saved" \
+  -H "Authorization: Bearer $token"
+
+# List, create and delete your bookmark folders
+curl -X GET "$BASE_URL/v1/user/$user_id/folders" \
+  -H "Authorization: Bearer $token"
+curl -X POST "$BASE_URL/v1/user/$user_id/folders" \
+  -H "Content-Type: application/json" \
+  -H "Authorization: Bearer $token" \
+  -d '{"name": "Read later"}'
+curl -X DELETE "$BASE_URL/v1/user/$user_id/folders/$folder_id" \
+  -H "Authorization: Bearer $token"
 
 # Restack a tweet
-curl -X PUT "$BASE_URL/restack/$user_id/$tweet_id" \
-  -H "Authorization: $user_id"
+curl -X PUT "$BASE_URL/v1/restack/$user_id/$tweet_id" \
+  -H "Authorization: Bearer $token"
+
+# Undo a restack
+curl -X PUT "$BASE_URL/v1/restack/$user_id/$tweet_id?remove=true" \
+  -H "Authorization: Bearer $token"
 
 # Follow a user
-curl -X PUT "$BASE_URL/follow/$user_id/$follow_id" \
-  -H "Authorization: $user_id"
+curl -X PUT "$BASE_URL/v1/follow/$user_id/$follow_id" \
+  -H "Authorization: Bearer $token"
+
+# Unfollow a user
+curl -X PUT "$BASE_URL/v1/follow/$user_id/$follow_id?remove=true" \
+  -H "Authorization: Bearer $token"
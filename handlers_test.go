@@ -1,16 +1,32 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/et-hicks/imitation-backend/models"
 	api "github.com/et-hicks/imitation-backend/src"
+	"github.com/et-hicks/imitation-backend/store"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
+	supabase "github.com/supabase-community/supabase-go"
 )
 
 // fakeSupabaseServer returns a test server that mimics minimal Supabase REST endpoints used by handlers.
@@ -29,19 +45,14 @@ func fakeSupabaseServer(t *testing.T) *httptest.Server {
 				return
 			}
 		}
-		// Tweets filtered by user_id
-		if uid := r.URL.Query().Get("user_id"); uid != "" {
-			// Expect format eq.<n>
-			if len(uid) > 3 && uid[:3] == "eq." {
-				nStr := uid[3:]
-				n, _ := strconv.Atoi(nStr)
-				// Return 10 tweets for this user
-				w.WriteHeader(http.StatusOK)
-				_, _ = w.Write([]byte(genTweetsJSON(10, func(i int) (id, userID int, body string) {
-					return i + 1, n, "Body"
-				})))
-				return
-			}
+		// Tweets by id list, as loaded for feeds; user n wrote tweets 10n-9..10n
+		if ids := r.URL.Query().Get("id"); strings.HasPrefix(ids, "in.(") {
+			list := strings.Split(strings.TrimSuffix(strings.TrimPrefix(ids, "in.("), ")"), ",")
+			_, _ = w.Write([]byte(genTweetsJSON(len(list), func(i int) (id, userID int, body string) {
+				id, _ = strconv.Atoi(list[i])
+				return id, (id-1)/10 + 1, "Body"
+			})))
+			return
 		}
 		// Default: return 10 tweets for /home
 		w.WriteHeader(http.StatusOK)
@@ -50,14 +61,33 @@ func fakeSupabaseServer(t *testing.T) *httptest.Server {
 		})))
 	})
 
-	// Users collection for auth validation
+	// user_feed lists user n's ten tweets, newest first
+	mux.HandleFunc("/rest/v1/rpc/user_feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var args struct {
+			Author int `json:"author"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&args)
+		type entry struct {
+			TweetID int       `json:"tweet_id"`
+			FeedAt  time.Time `json:"feed_at"`
+		}
+		entries := make([]entry, 0, 10)
+		for i := 10; i >= 1; i-- {
+			entries = append(entries, entry{TweetID: args.Author*10 - 10 + i, FeedAt: time.Date(2024, 1, i, 0, 0, 0, 0, time.UTC)})
+		}
+		_ = json.NewEncoder(w).Encode(entries)
+	})
+
+	// Users collection: users 1-10 exist
 	mux.HandleFunc("/rest/v1/users", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		if id := r.URL.Query().Get("id"); id == "eq.1" {
-			_, _ = w.Write([]byte(`[{"id":1}]`))
+		id := strings.TrimPrefix(r.URL.Query().Get("id"), "eq.")
+		if n, err := strconv.Atoi(id); err == nil && n >= 1 && n <= 10 {
+			_, _ = fmt.Fprintf(w, `[{"id":%d}]`, n)
 			return
 		}
-		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`[]`))
 	})
 
 	// Comments collection for posting comments
@@ -74,9 +104,16 @@ func fakeSupabaseServer(t *testing.T) *httptest.Server {
 
 	// user_tweet_interactions for likes/saves/restacks
 	mux.HandleFunc("/rest/v1/user_tweet_interactions", func(w http.ResponseWriter, r *http.Request) {
-		// Just acknowledge the write
 		_, _ = io.ReadAll(r.Body)
-		w.WriteHeader(http.StatusCreated)
+		switch r.Method {
+		case http.MethodGet, http.MethodPatch:
+			// No rows yet, so updates match nothing
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			// Just acknowledge the write
+			w.WriteHeader(http.StatusCreated)
+		}
 	})
 
 	// user_following for follow relationships
@@ -85,6 +122,37 @@ func fakeSupabaseServer(t *testing.T) *httptest.Server {
 		w.WriteHeader(http.StatusCreated)
 	})
 
+	// user_auth_map resolves auth user ids 1-11 to the matching public user
+	// id; public user 11 has since been deleted
+	mux.HandleFunc("/rest/v1/user_auth_map", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		authID := strings.TrimPrefix(r.URL.Query().Get("auth_user_id"), "eq.")
+		for n := 1; n <= 11; n++ {
+			if authID == testAuthUserID(n) {
+				_, _ = fmt.Fprintf(w, `[{"user_id":%d}]`, n)
+				return
+			}
+		}
+		_, _ = w.Write([]byte(`[]`))
+	})
+
+	// next_auth.sessions: "session-<n>" is a live session for auth user n
+	mux.HandleFunc("/rest/v1/sessions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Accept-Profile") != "next_auth" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":"42P01","message":"relation does not exist"}`))
+			return
+		}
+		token := strings.TrimPrefix(r.URL.Query().Get("sessionToken"), "eq.")
+		if n, err := strconv.Atoi(strings.TrimPrefix(token, "session-")); err == nil {
+			expires := time.Now().Add(time.Hour).Format(time.RFC3339)
+			_, _ = fmt.Fprintf(w, `[{"expires":%q,"userId":%q}]`, expires, testAuthUserID(n))
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	})
+
 	return httptest.NewServer(mux)
 }
 
@@ -108,10 +176,56 @@ func genTweetsJSON(n int, makeRow func(i int) (id, userID int, body string)) str
 	return string(b)
 }
 
+const testJWTSecret = "test-jwt-secret"
+
+// page is the envelope returned by paginated listings.
+type page struct {
+	Data       []map[string]any `json:"data"`
+	NextCursor *string          `json:"next_cursor"`
+}
+
+// decodePage decodes a paginated listing response.
+func decodePage(t *testing.T, rr *httptest.ResponseRecorder) page {
+	t.Helper()
+	var p page
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatalf("unmarshal: %v, body=%s", err, rr.Body.String())
+	}
+	return p
+}
+
 // setSupabaseEnv points the handlers to the fake Supabase server.
 func setSupabaseEnv(url string) {
 	_ = os.Setenv("SUPABASE_URL", url)
 	_ = os.Setenv("SUPABASE_KEY", "test-key")
+	_ = os.Setenv("SUPABASE_JWT_SECRET", testJWTSecret)
+}
+
+// testAuthUserID is the next_auth.users id the fake server maps to public user n.
+func testAuthUserID(n int) string {
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", n)
+}
+
+// signTestJWT returns an HS256 token for auth user n expiring after ttl.
+func signTestJWT(n int, ttl time.Duration) string {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims := enc.EncodeToString([]byte(fmt.Sprintf(`{"sub":%q,"exp":%d}`, testAuthUserID(n), time.Now().Add(ttl).Unix())))
+	mac := hmac.New(sha256.New, []byte(testJWTSecret))
+	mac.Write([]byte(header + "." + claims))
+	return header + "." + claims + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+// bearer returns an Authorization header value for public user n.
+func bearer(n int) string {
+	return "Bearer " + signTestJWT(n, time.Hour)
+}
+
+// serve runs a request through the authentication middleware and default mux.
+func serve(req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	api.Authenticate(http.DefaultServeMux).ServeHTTP(rr, req)
+	return rr
 }
 
 func TestHomeReturnsTen(t *testing.T) {
@@ -121,16 +235,12 @@ func TestHomeReturnsTen(t *testing.T) {
 	api.ResetSupabaseForTests()
 
 	req := httptest.NewRequest(http.MethodGet, "/home", nil)
-	rr := httptest.NewRecorder()
-	http.DefaultServeMux.ServeHTTP(rr, req)
+	rr := serve(req)
 
 	if rr.Code != http.StatusOK {
 		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
 	}
-	var got []map[string]any
-	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
-		t.Fatalf("unmarshal: %v", err)
-	}
+	got := decodePage(t, rr).Data
 	if len(got) != 10 {
 		t.Fatalf("want 10 rows, got %d", len(got))
 	}
@@ -143,16 +253,12 @@ func TestUser10ReturnsTenWithUserID10(t *testing.T) {
 	api.ResetSupabaseForTests()
 
 	req := httptest.NewRequest(http.MethodGet, "/user/10", nil)
-	rr := httptest.NewRecorder()
-	http.DefaultServeMux.ServeHTTP(rr, req)
+	rr := serve(req)
 
 	if rr.Code != http.StatusOK {
 		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
 	}
-	var got []map[string]any
-	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
-		t.Fatalf("unmarshal: %v", err)
-	}
+	got := decodePage(t, rr).Data
 	if len(got) != 10 {
 		t.Fatalf("want 10 rows, got %d", len(got))
 	}
@@ -170,8 +276,7 @@ func TestTweet1HasExpectedFields(t *testing.T) {
 	api.ResetSupabaseForTests()
 
 	req := httptest.NewRequest(http.MethodGet, "/tweet/1", nil)
-	rr := httptest.NewRecorder()
-	http.DefaultServeMux.ServeHTTP(rr, req)
+	rr := serve(req)
 
 	if rr.Code != http.StatusOK {
 		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
@@ -199,9 +304,8 @@ func TestCreateCommentRequiresParentHeader(t *testing.T) {
 
 	body := bytes.NewBufferString(`{"body":"hi","is_comment":true}`)
 	req := httptest.NewRequest(http.MethodPost, "/tweet", body)
-	req.Header.Set("Authorization", "1")
-	rr := httptest.NewRecorder()
-	http.DefaultServeMux.ServeHTTP(rr, req)
+	req.Header.Set("Authorization", bearer(1))
+	rr := serve(req)
 
 	if rr.Code != http.StatusBadRequest {
 		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
@@ -216,12 +320,12 @@ func TestCreateCommentValidatesUser(t *testing.T) {
 
 	body := bytes.NewBufferString(`{"body":"hi","is_comment":true}`)
 	req := httptest.NewRequest(http.MethodPost, "/tweet", body)
-	req.Header.Set("Authorization", "999")
+	// User 11 signs in but has no users row.
+	req.Header.Set("Authorization", bearer(11))
 	req.Header.Set("Parent-Tweet-ID", "42")
-	rr := httptest.NewRecorder()
-	http.DefaultServeMux.ServeHTTP(rr, req)
+	rr := serve(req)
 
-	if rr.Code != http.StatusUnauthorized {
+	if e := decodeError(t, rr); rr.Code != http.StatusUnauthorized || e.Message != "unknown user" {
 		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
 	}
 }
@@ -234,10 +338,9 @@ func TestCreateCommentSuccess(t *testing.T) {
 
 	body := bytes.NewBufferString(`{"body":"hi","is_comment":true}`)
 	req := httptest.NewRequest(http.MethodPost, "/tweet", body)
-	req.Header.Set("Authorization", "1")
+	req.Header.Set("Authorization", bearer(1))
 	req.Header.Set("Parent-Tweet-ID", "42")
-	rr := httptest.NewRecorder()
-	http.DefaultServeMux.ServeHTTP(rr, req)
+	rr := serve(req)
 
 	if rr.Code != http.StatusOK {
 		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
@@ -258,20 +361,18 @@ func TestLikeAuthCheck(t *testing.T) {
 	api.ResetSupabaseForTests()
 
 	req := httptest.NewRequest(http.MethodPut, "/like/2/10", nil)
-	req.Header.Set("Authorization", "1")
+	req.Header.Set("Authorization", bearer(1))
 	req.Header.Set("Is-Comment", "false")
-	rr := httptest.NewRecorder()
-	http.DefaultServeMux.ServeHTTP(rr, req)
+	rr := serve(req)
 
-	if rr.Code != http.StatusUnauthorized {
+	if rr.Code != http.StatusForbidden {
 		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
 	}
 
 	req2 := httptest.NewRequest(http.MethodPut, "/like/1/10", nil)
-	req2.Header.Set("Authorization", "1")
+	req2.Header.Set("Authorization", bearer(1))
 	req2.Header.Set("Is-Comment", "false")
-	rr2 := httptest.NewRecorder()
-	http.DefaultServeMux.ServeHTTP(rr2, req2)
+	rr2 := serve(req2)
 
 	if rr2.Code != http.StatusNoContent {
 		t.Fatalf("status = %d, body=%s", rr2.Code, rr2.Body.String())
@@ -285,19 +386,17 @@ func TestUnlikeAndUnsave(t *testing.T) {
 	api.ResetSupabaseForTests()
 
 	req := httptest.NewRequest(http.MethodPut, "/like/1/10?remove=true", nil)
-	req.Header.Set("Authorization", "1")
+	req.Header.Set("Authorization", bearer(1))
 	req.Header.Set("Is-Comment", "false")
-	rr := httptest.NewRecorder()
-	http.DefaultServeMux.ServeHTTP(rr, req)
+	rr := serve(req)
 
 	if rr.Code != http.StatusNoContent {
 		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
 	}
 
 	req2 := httptest.NewRequest(http.MethodPut, "/save/1/10?remove=true", nil)
-	req2.Header.Set("Authorization", "1")
-	rr2 := httptest.NewRecorder()
-	http.DefaultServeMux.ServeHTTP(rr2, req2)
+	req2.Header.Set("Authorization", bearer(1))
+	rr2 := serve(req2)
 
 	if rr2.Code != http.StatusNoContent {
 		t.Fatalf("status = %d, body=%s", rr2.Code, rr2.Body.String())
@@ -311,20 +410,1880 @@ func TestFollowAuthCheck(t *testing.T) {
 	api.ResetSupabaseForTests()
 
 	req := httptest.NewRequest(http.MethodPut, "/follow/2/3", nil)
-	req.Header.Set("Authorization", "1")
-	rr := httptest.NewRecorder()
-	http.DefaultServeMux.ServeHTTP(rr, req)
+	req.Header.Set("Authorization", bearer(1))
+	rr := serve(req)
 
-	if rr.Code != http.StatusUnauthorized {
+	if rr.Code != http.StatusForbidden {
 		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
 	}
 
 	req2 := httptest.NewRequest(http.MethodPut, "/follow/1/3", nil)
-	req2.Header.Set("Authorization", "1")
-	rr2 := httptest.NewRecorder()
-	http.DefaultServeMux.ServeHTTP(rr2, req2)
+	req2.Header.Set("Authorization", bearer(1))
+	rr2 := serve(req2)
 
 	if rr2.Code != http.StatusNoContent {
 		t.Fatalf("status = %d, body=%s", rr2.Code, rr2.Body.String())
 	}
 }
+
+func TestSessionTokenAuth(t *testing.T) {
+	srv := fakeSupabaseServer(t)
+	defer srv.Close()
+	setSupabaseEnv(srv.URL)
+	api.ResetSupabaseForTests()
+
+	req := httptest.NewRequest(http.MethodPut, "/save/3/10", nil)
+	req.Header.Set("Authorization", "Bearer session-3")
+	rr := serve(req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestUpdateBioMissingUser(t *testing.T) {
+	srv := fakeSupabaseServer(t)
+	defer srv.Close()
+	setSupabaseEnv(srv.URL)
+	api.ResetSupabaseForTests()
+
+	for id, want := range map[int]int{3: http.StatusNoContent, 11: http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodPost, "/user/"+strconv.Itoa(id)+"/bio", bytes.NewBufferString(`{"bio":"hello"}`))
+		req.Header.Set("Authorization", bearer(id))
+		if rr := serve(req); rr.Code != want {
+			t.Fatalf("user %d: status = %d, want %d, body=%s", id, rr.Code, want, rr.Body.String())
+		}
+	}
+}
+
+func TestRejectsMissingOrInvalidCredentials(t *testing.T) {
+	srv := fakeSupabaseServer(t)
+	defer srv.Close()
+	setSupabaseEnv(srv.URL)
+	api.ResetSupabaseForTests()
+
+	cases := map[string]string{
+		"missing":  "",
+		"raw id":   "1",
+		"expired":  "Bearer " + signTestJWT(1, -time.Minute),
+		"forged":   "Bearer " + signTestJWT(1, time.Hour) + "x",
+		"unknown":  "Bearer session-none",
+		"unmapped": bearer(42),
+	}
+	for name, auth := range cases {
+		req := httptest.NewRequest(http.MethodPut, "/restack/1/10", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rr := serve(req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: status = %d, body=%s", name, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// missingTweetStore reports every tweet as missing; other methods are unused.
+type missingTweetStore struct {
+	store.Store
+}
+
+func (missingTweetStore) GetTweet(ctx context.Context, tweetID int) (models.TweetWithUser, error) {
+	return models.TweetWithUser{}, store.ErrNotFound
+}
+
+func TestFetchTweetNotFound(t *testing.T) {
+	api.SetStoreForTests(missingTweetStore{})
+	defer api.ResetSupabaseForTests()
+
+	req := httptest.NewRequest(http.MethodGet, "/tweet/5", nil)
+	rr := serve(req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+// failingUserStore fails every user lookup, as a database outage would.
+type failingUserStore struct {
+	store.Store
+}
+
+func (failingUserStore) GetUser(ctx context.Context, userID int) (models.User, error) {
+	return models.User{}, errors.New("connection refused")
+}
+
+func TestCreateCommentUserLookupFailure(t *testing.T) {
+	mem := useMemoryStore(t)
+	api.SetStoreForTests(failingUserStore{mem})
+
+	req := httptest.NewRequest(http.MethodPost, "/tweet", bytes.NewBufferString(`{"body":"hi","is_comment":true}`))
+	req.Header.Set("Authorization", "Bearer dev-session-2")
+	req.Header.Set("Parent-Tweet-ID", "1")
+	rr := serve(req)
+	if e := decodeError(t, rr); rr.Code != http.StatusInternalServerError || e.Code != "internal" {
+		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+// memorySeed is the fixture set loaded into in-memory stores under test.
+const memorySeed = "sql/users.sql,sql/tweets.sql,sql/comments.sql,sql/dev_sessions.sql"
+
+// useMemoryStore points the handlers at an in-memory store seeded from the sql/ fixtures.
+func useMemoryStore(t *testing.T) *store.Memory {
+	t.Helper()
+	mem := store.NewMemory()
+	if err := mem.SeedFiles(strings.Split(memorySeed, ",")...); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	api.SetStoreForTests(mem)
+	t.Cleanup(api.ResetSupabaseForTests)
+	return mem
+}
+
+func TestMemoryBackendRunsOffline(t *testing.T) {
+	t.Setenv("SUPABASE_URL", "")
+	t.Setenv("SUPABASE_KEY", "")
+	t.Setenv("STORE_BACKEND", "memory")
+	t.Setenv("MEMORY_SEED", memorySeed)
+	api.ResetSupabaseForTests()
+	defer api.ResetSupabaseForTests()
+
+	rr := serve(httptest.NewRequest(http.MethodGet, "/home", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+	home := decodePage(t, rr).Data
+	if len(home) != 10 || home[0]["id"].(float64) != 100 {
+		t.Fatalf("want 10 rows starting with tweet 100, got %d rows: %v", len(home), home[0]["id"])
+	}
+	if user, ok := home[0]["users"].(map[string]any); !ok || user["username"] != "astro_lee" {
+		t.Fatalf("want author astro_lee, got %v", home[0]["users"])
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/tweet", bytes.NewBufferString(`{"body":"offline reply","is_comment":true}`))
+	req.Header.Set("Authorization", "Bearer dev-session-2")
+	req.Header.Set("Parent-Tweet-ID", "1")
+	if rr := serve(req); rr.Code != http.StatusOK {
+		t.Fatalf("create comment: status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = serve(httptest.NewRequest(http.MethodGet, "/tweet/1/comments", nil))
+	comments := decodePage(t, rr).Data
+	if len(comments) != 3 || comments[0]["body"] != "offline reply" {
+		t.Fatalf("want new comment first of 3, got %v", comments)
+	}
+}
+
+func TestMemoryStoreMissingTweet(t *testing.T) {
+	useMemoryStore(t)
+
+	rr := serve(httptest.NewRequest(http.MethodGet, "/tweet/1000", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+// TestPostgresStore runs against a disposable database named by
+// TEST_DATABASE_URL; its tables are recreated from sql/schema.sql and seeded
+// from the fixtures.
+func TestPostgresStore(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close(ctx)
+	setup := []string{"DROP TABLE IF EXISTS notification_actors, notifications, mentions, tweet_hashtags, edit_history, user_following, bookmark_folders, user_tweet_interactions, comments, tweets, users CASCADE"}
+	for _, path := range []string{"sql/schema.sql", "sql/users.sql", "sql/tweets.sql", "sql/comments.sql", "sql/counters.sql", "sql/timeline.sql", "sql/edits.sql", "sql/bookmarks.sql", "sql/likes.sql", "sql/search.sql", "sql/hashtags.sql", "sql/mentions.sql", "sql/notifications.sql"} {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		setup = append(setup, string(src))
+	}
+	setup = append(setup,
+		"SELECT setval('users_id_seq', (SELECT max(id) FROM users))",
+		"SELECT setval('tweets_id_seq', (SELECT max(id) FROM tweets))",
+		"SELECT setval('comments_id_seq', (SELECT max(id) FROM comments))")
+	for _, sql := range setup {
+		if _, err := conn.PgConn().Exec(ctx, sql).ReadAll(); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	st, err := store.OpenPostgres(ctx, url)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer st.Close()
+
+	home, err := st.LatestTweets(ctx, store.Page{Limit: 10})
+	if err != nil || len(home) != 10 || home[0].ID != 100 || home[0].User.Username != "astro_lee" {
+		t.Fatalf("latest tweets: %v %+v", err, home)
+	}
+
+	if _, err := st.CreateComment(ctx, 2, 1, "direct reply"); err != nil {
+		t.Fatalf("create comment: %v", err)
+	}
+	if _, err := st.CreateComment(ctx, 2, 1000, "orphan"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("comment on missing tweet: want ErrNotFound, got %v", err)
+	}
+	comments, err := st.TweetComments(ctx, 1, store.Page{Limit: 10})
+	if err != nil || len(comments) != 3 || comments[0].Body != "direct reply" {
+		t.Fatalf("comments: %v %+v", err, comments)
+	}
+
+	like := store.Target{ID: 1}
+	for _, active := range []bool{true, true} {
+		if _, err := st.SetInteraction(ctx, 2, like, store.Like, active); err != nil {
+			t.Fatalf("set like %v: %v", active, err)
+		}
+	}
+	if tweet, _ := st.GetTweet(ctx, 1); tweet.Likes != 211 || tweet.Comments != 4 {
+		t.Fatalf("trigger-maintained counters: %+v", tweet.Tweet)
+	}
+	if changed, err := st.ReconcileCounters(ctx); err != nil || changed == 0 {
+		t.Fatalf("reconcile: %d %v", changed, err)
+	}
+	if tweet, _ := st.GetTweet(ctx, 1); tweet.Likes != 1 || tweet.Comments != 3 {
+		t.Fatalf("reconciled counters: %+v", tweet.Tweet)
+	}
+
+	if err := st.Follow(ctx, 1, 2); err != nil {
+		t.Fatalf("follow: %v", err)
+	}
+	if _, err := st.SetInteraction(ctx, 2, store.Target{ID: 21}, store.Restack, true); err != nil {
+		t.Fatalf("restack: %v", err)
+	}
+	feed, err := st.FollowingTimeline(ctx, 1, store.Page{Limit: 3})
+	if err != nil || len(feed) != 3 || feed[0].ID != 21 || feed[0].RestackedBy == nil || feed[0].RestackedBy.ID != 2 {
+		t.Fatalf("following timeline: %v %+v", err, feed)
+	}
+	if own, err := st.UserFeed(ctx, 2, store.Page{Limit: 1}); err != nil || len(own) != 1 || own[0].ID != 21 || own[0].Kind != models.FeedRestack {
+		t.Fatalf("user feed: %v %+v", err, own)
+	}
+	if likes, err := st.LikedItems(ctx, 2, store.Page{Limit: 10}); err != nil || len(likes) != 1 || likes[0].Tweet == nil || likes[0].Tweet.ID != 1 {
+		t.Fatalf("liked items: %v %+v", err, likes)
+	}
+	if likers, err := st.Interactors(ctx, like, store.Like, store.Page{Limit: 10}); err != nil || len(likers) != 1 || likers[0].ID != 2 {
+		t.Fatalf("likers: %v %+v", err, likers)
+	}
+	q, _ := store.ParseSearchQuery(`"machine learning" from:ana_sky`)
+	if found, err := st.SearchTweets(ctx, q, 10, 0); err != nil || len(found) != 1 || found[0].ID != 1 {
+		t.Fatalf("search tweets: %v %+v", err, found)
+	}
+	q, _ = store.ParseSearchQuery("astro")
+	if found, err := st.SearchUsers(ctx, q, 10, 0); err != nil || len(found) != 1 || found[0].Username != "astro_lee" {
+		t.Fatalf("search users: %v %+v", err, found)
+	}
+	if _, err := st.SetInteraction(ctx, 2, store.Target{ID: 3}, store.Save, true); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	folder, err := st.CreateBookmarkFolder(ctx, 2, "later")
+	if err != nil {
+		t.Fatalf("create folder: %v", err)
+	}
+	if _, err := st.CreateBookmarkFolder(ctx, 2, "later"); !errors.Is(err, store.ErrConflict) {
+		t.Fatalf("duplicate folder: want ErrConflict, got %v", err)
+	}
+	if err := st.FileSave(ctx, 2, 3, &folder.ID); err != nil {
+		t.Fatalf("file save: %v", err)
+	}
+	if saved, err := st.SavedTweets(ctx, 2, &folder.ID, store.Page{Limit: 10}); err != nil || len(saved) != 1 || saved[0].ID != 3 {
+		t.Fatalf("saved tweets: %v %+v", err, saved)
+	}
+	states, err := st.ViewerStates(ctx, 2, []store.Target{like, {ID: 21}, {ID: 2}})
+	if err != nil || !states[like].Liked || !states[store.Target{ID: 21}].Restacked || states[store.Target{ID: 2}] != (models.ViewerState{}) {
+		t.Fatalf("viewer states: %v %+v", err, states)
+	}
+
+	if _, err := st.EditTweet(ctx, 2, 1, "not mine"); !errors.Is(err, store.ErrForbidden) {
+		t.Fatalf("edit someone else's tweet: want ErrForbidden, got %v", err)
+	}
+	if edited, err := st.EditTweet(ctx, 1, 1, "edited"); err != nil || !edited.IsEdited || edited.Body != "edited" {
+		t.Fatalf("edit tweet: %v %+v", err, edited)
+	}
+	if tagged, err := st.HashtagTweets(ctx, "edited", store.Page{Limit: 10}); err != nil || len(tagged) != 0 {
+		t.Fatalf("hashtag before tagging: %v %+v", err, tagged)
+	}
+	if _, err := st.EditTweet(ctx, 1, 1, "now #Edited"); err != nil {
+		t.Fatalf("edit with hashtag: %v", err)
+	}
+	if tagged, err := st.HashtagTweets(ctx, "edited", store.Page{Limit: 10}); err != nil || len(tagged) != 1 || tagged[0].ID != 1 {
+		t.Fatalf("hashtag tweets: %v %+v", err, tagged)
+	}
+	if _, err := st.EditTweet(ctx, 1, 1, "now #Edited with @Astro_Lee"); err != nil {
+		t.Fatalf("edit with mention: %v", err)
+	}
+	if mentions, err := st.Mentions(ctx, 10, store.Page{Limit: 10}); err != nil || len(mentions) != 1 || mentions[0].Tweet == nil || mentions[0].Tweet.ID != 1 {
+		t.Fatalf("mentions: %v %+v", err, mentions)
+	}
+	if notes, err := st.Notifications(ctx, 10, store.Page{Limit: 10}); err != nil || len(notes) != 1 || notes[0].Kind != models.NotifyMention || notes[0].Summary != "Ana Sky mentioned you in a tweet" {
+		t.Fatalf("notifications: %v %+v", err, notes)
+	}
+	if err := st.MarkNotificationsRead(ctx, 10, nil); err != nil {
+		t.Fatalf("mark read: %v", err)
+	}
+	if unread, err := st.UnreadNotifications(ctx, 10); err != nil || unread != 0 {
+		t.Fatalf("unread: %v %d", err, unread)
+	}
+	if users, err := st.UsersByUsername(ctx, []string{"astro_lee", "nobody"}); err != nil || len(users) != 1 || users["astro_lee"].ID != 10 {
+		t.Fatalf("users by username: %v %+v", err, users)
+	}
+	if history, err := st.History(ctx, store.Target{ID: 1}, store.Page{Limit: 10}); err != nil || len(history) != 3 {
+		t.Fatalf("history: %v %+v", err, history)
+	}
+
+	reply, err := st.CreateReply(ctx, 3, comments[0].ID, "threaded")
+	if err != nil || reply.TweetID != 1 {
+		t.Fatalf("create reply: %v %+v", err, reply)
+	}
+	if thread, err := st.CommentThread(ctx, comments[0].ID, 2); err != nil || len(thread.Children) != 1 || thread.Replies != 1 {
+		t.Fatalf("comment thread: %v %+v", err, thread)
+	}
+
+	if err := st.DeleteTweet(ctx, 2, 1); !errors.Is(err, store.ErrForbidden) {
+		t.Fatalf("delete someone else's tweet: want ErrForbidden, got %v", err)
+	}
+	if err := st.DeleteTweet(ctx, 1, 1); err != nil {
+		t.Fatalf("delete tweet with comments and interactions: %v", err)
+	}
+	if _, err := st.GetTweet(ctx, 1); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("deleted tweet: want ErrNotFound, got %v", err)
+	}
+
+	rollback := errors.New("rollback")
+	err = st.WithTx(ctx, func(tx *store.Postgres) error {
+		if _, err := tx.CreateTweet(ctx, 3, "never committed"); err != nil {
+			return err
+		}
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatalf("tx: %v", err)
+	}
+	latest, _ := st.LatestTweets(ctx, store.Page{Limit: 1})
+	if len(latest) != 1 || latest[0].Body == "never committed" {
+		t.Fatalf("rolled back tweet is visible: %+v", latest)
+	}
+}
+
+// getTweet fetches /tweet/{id} and decodes it.
+func getTweet(t *testing.T, id int) models.TweetWithUser {
+	t.Helper()
+	rr := serve(httptest.NewRequest(http.MethodGet, "/tweet/"+strconv.Itoa(id), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("get tweet %d: status = %d, body=%s", id, rr.Code, rr.Body.String())
+	}
+	var tweet models.TweetWithUser
+	if err := json.Unmarshal(rr.Body.Bytes(), &tweet); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return tweet
+}
+
+func TestCountersFollowInteractions(t *testing.T) {
+	mem := useMemoryStore(t)
+	before := getTweet(t, 5)
+
+	for _, path := range []string{"/like/1/5", "/like/1/5", "/save/1/5", "/restack/1/5"} {
+		req := httptest.NewRequest(http.MethodPut, path, nil)
+		req.Header.Set("Authorization", "Bearer dev-session-1")
+		req.Header.Set("Is-Comment", "false")
+		if rr := serve(req); rr.Code != http.StatusNoContent {
+			t.Fatalf("%s: status = %d, body=%s", path, rr.Code, rr.Body.String())
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/tweet", bytes.NewBufferString(`{"body":"counted","is_comment":true}`))
+	req.Header.Set("Authorization", "Bearer dev-session-1")
+	req.Header.Set("Parent-Tweet-ID", "5")
+	if rr := serve(req); rr.Code != http.StatusOK {
+		t.Fatalf("comment: status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+
+	after := getTweet(t, 5)
+	if after.Likes != before.Likes+1 || after.Saves != before.Saves+1 || after.Restacks != before.Restacks+1 || after.Comments != before.Comments+1 {
+		t.Fatalf("counters before %+v after %+v", before.Tweet, after.Tweet)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/like/1/5?remove=true", nil)
+	req.Header.Set("Authorization", "Bearer dev-session-1")
+	req.Header.Set("Is-Comment", "false")
+	serve(req)
+	if got := getTweet(t, 5).Likes; got != before.Likes {
+		t.Fatalf("likes after unlike = %d, want %d", got, before.Likes)
+	}
+
+	if _, err := mem.ReconcileCounters(context.Background()); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	got := getTweet(t, 5)
+	if got.Likes != 0 || got.Saves != 1 || got.Restacks != 1 || got.Comments != 3 || got.Replies != 3 {
+		t.Fatalf("reconciled counters %+v", got.Tweet)
+	}
+}
+
+func TestCursorPaginationWalksEveryTweet(t *testing.T) {
+	useMemoryStore(t)
+
+	seen := map[float64]bool{}
+	var last float64 = 1 << 30
+	url := "/user/2?limit=3"
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatalf("pagination did not terminate")
+		}
+		rr := serve(httptest.NewRequest(http.MethodGet, url, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
+		}
+		p := decodePage(t, rr)
+		if len(p.Data) > 3 {
+			t.Fatalf("page of %d rows exceeds limit", len(p.Data))
+		}
+		for _, row := range p.Data {
+			id := row["id"].(float64)
+			if seen[id] || id >= last {
+				t.Fatalf("tweet %v out of order or repeated", id)
+			}
+			seen[id], last = true, id
+		}
+		if p.NextCursor == nil {
+			break
+		}
+		url = "/user/2?limit=3&cursor=" + *p.NextCursor
+	}
+	if len(seen) != 10 {
+		t.Fatalf("saw %d tweets, want 10", len(seen))
+	}
+
+	for _, bad := range []string{"/home?limit=0", "/home?limit=101", "/home?cursor=bogus", "/tweet/1/comments?limit=x"} {
+		if rr := serve(httptest.NewRequest(http.MethodGet, bad, nil)); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d", bad, rr.Code)
+		}
+	}
+}
+
+func TestFollowingTimeline(t *testing.T) {
+	useMemoryStore(t)
+
+	for _, step := range []struct{ path, session string }{
+		{"/follow/1/2", "dev-session-1"},
+		{"/restack/2/21", "dev-session-2"},
+	} {
+		req := httptest.NewRequest(http.MethodPut, step.path, nil)
+		req.Header.Set("Authorization", "Bearer "+step.session)
+		if rr := serve(req); rr.Code != http.StatusNoContent {
+			t.Fatalf("%s: status = %d, body=%s", step.path, rr.Code, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/home?mode=following&limit=100", nil)
+	req.Header.Set("Authorization", "Bearer dev-session-1")
+	rr := serve(req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+	var feed struct {
+		Data []models.FeedItem `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	// Users 1 and 2 wrote ten tweets each, plus user 2's restack of tweet 21.
+	if len(feed.Data) != 21 {
+		t.Fatalf("len = %d, want 21", len(feed.Data))
+	}
+	first := feed.Data[0]
+	if first.ID != 21 || first.Kind != models.FeedRestack || first.RestackedBy == nil || first.RestackedBy.ID != 2 {
+		t.Fatalf("first item = %+v, want tweet 21 restacked by user 2", first)
+	}
+	for _, item := range feed.Data[1:] {
+		if item.UserID != 1 && item.UserID != 2 || item.RestackedBy != nil {
+			t.Fatalf("unexpected item %+v", item)
+		}
+	}
+
+	if rr := serve(httptest.NewRequest(http.MethodGet, "/home?mode=following", nil)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous following: status = %d", rr.Code)
+	}
+	if rr := serve(httptest.NewRequest(http.MethodGet, "/home?mode=sideways", nil)); rr.Code != http.StatusBadRequest {
+		t.Fatalf("unknown mode: status = %d", rr.Code)
+	}
+	for _, path := range []string{"/home?mode=explore", "/home"} {
+		req = httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer dev-session-1")
+		if p := decodePage(t, serve(req)); len(p.Data) != 10 || p.Data[0]["id"].(float64) != 100 {
+			t.Fatalf("%s feed = %+v", path, p.Data)
+		}
+	}
+}
+
+func TestFollowingTimelineEntryPerRestack(t *testing.T) {
+	useMemoryStore(t)
+
+	for _, step := range []struct{ path, session string }{
+		{"/follow/5/1", "dev-session-5"},
+		{"/follow/5/2", "dev-session-5"},
+		{"/follow/5/3", "dev-session-5"},
+		{"/restack/2/1", "dev-session-2"},
+		{"/restack/3/1", "dev-session-3"},
+	} {
+		req := httptest.NewRequest(http.MethodPut, step.path, nil)
+		req.Header.Set("Authorization", "Bearer "+step.session)
+		if rr := serve(req); rr.Code != http.StatusNoContent {
+			t.Fatalf("%s: status = %d, body=%s", step.path, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Walk the timeline one entry at a time: tweet 1 appears for each
+	// restack, newest first, and for its post.
+	var restackers []int
+	seen := map[[2]int]bool{}
+	url := "/home?mode=following&limit=1"
+	for {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Authorization", "Bearer dev-session-5")
+		rr := serve(req)
+		var feed struct {
+			Data       []models.FeedItem `json:"data"`
+			NextCursor *string           `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil || len(feed.Data) != 1 {
+			t.Fatalf("page: %v, body=%s", err, rr.Body.String())
+		}
+		item := feed.Data[0]
+		key := [2]int{item.ID, 0}
+		if item.RestackedBy != nil {
+			key[1] = item.RestackedBy.ID
+		}
+		if seen[key] {
+			t.Fatalf("entry %v repeated", key)
+		}
+		seen[key] = true
+		if item.ID == 1 {
+			restackers = append(restackers, key[1])
+		}
+		if feed.NextCursor == nil {
+			break
+		}
+		url = "/home?mode=following&limit=1&cursor=" + *feed.NextCursor
+	}
+	if !slices.Equal(restackers, []int{3, 2, 0}) {
+		t.Fatalf("tweet 1 entries restacked by %v, want [3 2 0]", restackers)
+	}
+}
+
+func TestFollowGraphListingsAndUnfollow(t *testing.T) {
+	useMemoryStore(t)
+
+	follow := func(from, to int, remove bool) {
+		t.Helper()
+		path := fmt.Sprintf("/follow/%d/%d", from, to)
+		if remove {
+			path += "?remove=true"
+		}
+		req := httptest.NewRequest(http.MethodPut, path, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer dev-session-%d", from))
+		if rr := serve(req); rr.Code != http.StatusNoContent {
+			t.Fatalf("%s: status = %d, body=%s", path, rr.Code, rr.Body.String())
+		}
+	}
+	for _, from := range []int{2, 3, 4} {
+		follow(from, 1, false)
+	}
+	follow(1, 2, false)
+	follow(3, 1, true)
+
+	rr := serve(httptest.NewRequest(http.MethodGet, "/user/1?limit=1", nil))
+	var profile struct {
+		User models.Profile `json:"user"`
+		Data []models.TweetWithUser
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &profile); err != nil {
+		t.Fatalf("unmarshal: %v, body=%s", err, rr.Body.String())
+	}
+	if profile.User.ID != 1 || profile.User.Followers != 2 || profile.User.Following != 1 || len(profile.Data) != 1 {
+		t.Fatalf("profile = %+v", profile)
+	}
+
+	p := decodePage(t, serve(httptest.NewRequest(http.MethodGet, "/user/1/followers?limit=1", nil)))
+	if len(p.Data) != 1 || p.Data[0]["id"].(float64) != 4 || p.NextCursor == nil {
+		t.Fatalf("first followers page = %+v", p)
+	}
+	p = decodePage(t, serve(httptest.NewRequest(http.MethodGet, "/user/1/followers?limit=1&cursor="+*p.NextCursor, nil)))
+	if len(p.Data) != 1 || p.Data[0]["id"].(float64) != 2 || p.NextCursor != nil {
+		t.Fatalf("second followers page = %+v", p)
+	}
+	p = decodePage(t, serve(httptest.NewRequest(http.MethodGet, "/user/1/following", nil)))
+	if len(p.Data) != 1 || p.Data[0]["id"].(float64) != 2 {
+		t.Fatalf("following = %+v", p)
+	}
+
+	if rr := serve(httptest.NewRequest(http.MethodGet, "/user/999", nil)); rr.Code != http.StatusNotFound {
+		t.Fatalf("missing user: status = %d", rr.Code)
+	}
+	for _, path := range []string{"/v1/user/999/followers", "/v1/user/999/following"} {
+		rr := serve(httptest.NewRequest(http.MethodGet, path, nil))
+		if e := decodeError(t, rr); rr.Code != http.StatusNotFound || e.Code != "not_found" || e.Message != "user not found" {
+			t.Fatalf("%s: status = %d, error = %+v", path, rr.Code, e)
+		}
+	}
+}
+
+func TestRestackEntriesAndUndo(t *testing.T) {
+	useMemoryStore(t)
+	restack := func(remove bool) {
+		t.Helper()
+		path := "/restack/2/1"
+		if remove {
+			path += "?remove=true"
+		}
+		req := httptest.NewRequest(http.MethodPut, path, nil)
+		req.Header.Set("Authorization", "Bearer dev-session-2")
+		if rr := serve(req); rr.Code != http.StatusNoContent {
+			t.Fatalf("%s: status = %d, body=%s", path, rr.Code, rr.Body.String())
+		}
+	}
+	firstEntry := func() models.FeedItem {
+		t.Helper()
+		var feed struct {
+			Data []models.FeedItem `json:"data"`
+		}
+		rr := serve(httptest.NewRequest(http.MethodGet, "/user/2?limit=1", nil))
+		if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil || len(feed.Data) != 1 {
+			t.Fatalf("profile feed: %v, body=%s", err, rr.Body.String())
+		}
+		return feed.Data[0]
+	}
+	before := getTweet(t, 1).Restacks
+
+	restack(false)
+	item := firstEntry()
+	if item.Kind != models.FeedRestack || item.ID != 1 || item.User.ID != 1 || item.RestackedBy == nil || item.RestackedBy.ID != 2 {
+		t.Fatalf("restack entry = %+v", item)
+	}
+
+	restack(true)
+	if item := firstEntry(); item.Kind != models.FeedTweet || item.UserID != 2 {
+		t.Fatalf("entry after undo = %+v", item)
+	}
+	if got := getTweet(t, 1).Restacks; got != before {
+		t.Fatalf("restacks after undo = %d, want %d", got, before)
+	}
+}
+
+func TestEditTweetAndHistory(t *testing.T) {
+	useMemoryStore(t)
+	original := getTweet(t, 1).Body
+
+	edit := func(id, session int, isComment bool, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/tweet/"+strconv.Itoa(id), bytes.NewBufferString(`{"body":`+strconv.Quote(body)+`}`))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer dev-session-%d", session))
+		req.Header.Set("Is-Comment", strconv.FormatBool(isComment))
+		return serve(req)
+	}
+
+	if rr := edit(1, 2, false, "hijacked"); rr.Code != http.StatusForbidden {
+		t.Fatalf("non-owner edit: status = %d", rr.Code)
+	}
+	// Unknown mentions in someone else's tweet or comment are not looked at.
+	if rr := edit(1, 2, false, "hi @nobody_here"); rr.Code != http.StatusForbidden {
+		t.Fatalf("non-owner edit with mention: status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := edit(2, 1, true, "hi @nobody_here"); rr.Code != http.StatusForbidden {
+		t.Fatalf("non-owner comment edit with mention: status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := edit(1000, 1, true, "nothing"); rr.Code != http.StatusNotFound {
+		t.Fatalf("missing comment edit: status = %d", rr.Code)
+	}
+	if rr := edit(1000, 1, false, "nothing"); rr.Code != http.StatusNotFound {
+		t.Fatalf("missing tweet edit: status = %d", rr.Code)
+	}
+	for _, body := range []string{"first edit", "second edit"} {
+		if rr := edit(1, 1, false, body); rr.Code != http.StatusOK {
+			t.Fatalf("edit: status = %d, body=%s", rr.Code, rr.Body.String())
+		}
+	}
+	if rr := edit(2, 2, true, "edited comment"); rr.Code != http.StatusOK {
+		t.Fatalf("comment edit: status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+
+	tweet := getTweet(t, 1)
+	if tweet.Body != "second edit" || !tweet.IsEdited || tweet.LastEditedAt.IsZero() {
+		t.Fatalf("edited tweet = %+v", tweet.Tweet)
+	}
+	p := decodePage(t, serve(httptest.NewRequest(http.MethodGet, "/tweet/1/history", nil)))
+	if len(p.Data) != 2 || p.Data[0]["body"] != "first edit" || p.Data[1]["body"] != original {
+		t.Fatalf("tweet history = %+v", p.Data)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/tweet/2/history", nil)
+	req.Header.Set("Is-Comment", "true")
+	if p := decodePage(t, serve(req)); len(p.Data) != 1 || p.Data[0]["comment_id"].(float64) != 2 {
+		t.Fatalf("comment history = %+v", p.Data)
+	}
+	if rr := serve(httptest.NewRequest(http.MethodGet, "/tweet/1000/history", nil)); rr.Code != http.StatusNotFound {
+		t.Fatalf("missing tweet history: status = %d", rr.Code)
+	}
+}
+
+func TestDeleteTweetsAndComments(t *testing.T) {
+	mem := useMemoryStore(t)
+	ctx := context.Background()
+	del := func(id, session int, isComment bool) int {
+		req := httptest.NewRequest(http.MethodDelete, "/tweet/"+strconv.Itoa(id), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer dev-session-%d", session))
+		req.Header.Set("Is-Comment", strconv.FormatBool(isComment))
+		return serve(req).Code
+	}
+
+	before := getTweet(t, 1)
+	comment, err := mem.CreateComment(ctx, 3, 1, "short-lived")
+	if err != nil {
+		t.Fatalf("create comment: %v", err)
+	}
+	if _, err := mem.SetInteraction(ctx, 2, store.Target{ID: comment.ID, IsComment: true}, store.Like, true); err != nil {
+		t.Fatalf("like comment: %v", err)
+	}
+	if code := del(comment.ID, 1, true); code != http.StatusForbidden {
+		t.Fatalf("non-owner comment delete: status = %d", code)
+	}
+	if code := del(comment.ID, 3, true); code != http.StatusNoContent {
+		t.Fatalf("comment delete: status = %d", code)
+	}
+	if after := getTweet(t, 1); after.Comments != before.Comments || after.Replies != before.Replies {
+		t.Fatalf("counters after comment delete %+v, want %+v", after.Tweet, before.Tweet)
+	}
+
+	if _, err := mem.SetInteraction(ctx, 2, store.Target{ID: 1}, store.Restack, true); err != nil {
+		t.Fatalf("restack: %v", err)
+	}
+	if code := del(1, 2, false); code != http.StatusForbidden {
+		t.Fatalf("non-owner tweet delete: status = %d", code)
+	}
+	if code := del(1, 1, false); code != http.StatusNoContent {
+		t.Fatalf("tweet delete: status = %d", code)
+	}
+	if code := del(1, 1, false); code != http.StatusNotFound {
+		t.Fatalf("second delete: status = %d", code)
+	}
+	if rr := serve(httptest.NewRequest(http.MethodGet, "/tweet/1", nil)); rr.Code != http.StatusNotFound {
+		t.Fatalf("deleted tweet: status = %d", rr.Code)
+	}
+	if p := decodePage(t, serve(httptest.NewRequest(http.MethodGet, "/tweet/1/comments", nil))); len(p.Data) != 0 {
+		t.Fatalf("comments of deleted tweet = %+v", p.Data)
+	}
+	feed, _ := mem.UserFeed(ctx, 2, store.Page{Limit: 100})
+	for _, item := range feed {
+		if item.ID == 1 {
+			t.Fatalf("deleted tweet still in restacker's feed: %+v", item)
+		}
+	}
+}
+
+func TestThreadedReplies(t *testing.T) {
+	useMemoryStore(t)
+	before := getTweet(t, 1)
+	reply := func(session, parentID int) models.Comment {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/tweet", bytes.NewBufferString(`{"body":"reply","is_comment":true}`))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer dev-session-%d", session))
+		req.Header.Set("Parent-Comment-ID", strconv.Itoa(parentID))
+		rr := serve(req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("reply to %d: status = %d, body=%s", parentID, rr.Code, rr.Body.String())
+		}
+		var c models.Comment
+		if err := json.Unmarshal(rr.Body.Bytes(), &c); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return c
+	}
+	a := reply(2, 1)
+	b := reply(3, a.ID)
+	reply(1, b.ID)
+	if a.TweetID != 1 || a.ParentCommentID == nil || *a.ParentCommentID != 1 {
+		t.Fatalf("reply = %+v", a)
+	}
+
+	rr := serve(httptest.NewRequest(http.MethodGet, "/comment/1/replies?depth=2", nil))
+	var thread models.CommentThread
+	if err := json.Unmarshal(rr.Body.Bytes(), &thread); err != nil {
+		t.Fatalf("unmarshal: %v, body=%s", err, rr.Body.String())
+	}
+	if thread.ID != 1 || len(thread.Children) != 1 || thread.Children[0].ID != a.ID {
+		t.Fatalf("thread root = %+v", thread)
+	}
+	deepest := thread.Children[0].Children
+	if len(deepest) != 1 || deepest[0].ID != b.ID || len(deepest[0].Children) != 0 || deepest[0].Replies != 1 {
+		t.Fatalf("depth-limited level = %+v", deepest)
+	}
+
+	after := getTweet(t, 1)
+	if after.Comments != before.Comments+3 || after.Replies != before.Replies {
+		t.Fatalf("counters after replies %+v, before %+v", after.Tweet, before.Tweet)
+	}
+	for _, c := range decodePage(t, serve(httptest.NewRequest(http.MethodGet, "/tweet/1/comments", nil))).Data {
+		if c["parent_comment_id"] != nil {
+			t.Fatalf("reply listed as top-level comment: %+v", c)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/tweet/"+strconv.Itoa(a.ID), nil)
+	req.Header.Set("Authorization", "Bearer dev-session-2")
+	req.Header.Set("Is-Comment", "true")
+	if rr := serve(req); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete reply: status = %d", rr.Code)
+	}
+	if got := getTweet(t, 1); got.Comments != before.Comments {
+		t.Fatalf("comments after deleting subtree = %d, want %d", got.Comments, before.Comments)
+	}
+	if rr := serve(httptest.NewRequest(http.MethodGet, "/comment/"+strconv.Itoa(b.ID)+"/replies", nil)); rr.Code != http.StatusNotFound {
+		t.Fatalf("nested reply survived its parent: status = %d", rr.Code)
+	}
+	if rr := serve(httptest.NewRequest(http.MethodGet, "/comment/1/replies?depth=0", nil)); rr.Code != http.StatusBadRequest {
+		t.Fatalf("depth=0: status = %d", rr.Code)
+	}
+}
+
+func TestViewerStateOnPayloads(t *testing.T) {
+	useMemoryStore(t)
+	interact := func(path, isComment string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, path, nil)
+		req.Header.Set("Authorization", "Bearer dev-session-3")
+		req.Header.Set("Is-Comment", isComment)
+		if rr := serve(req); rr.Code != http.StatusNoContent {
+			t.Fatalf("PUT %s: status = %d, body=%s", path, rr.Code, rr.Body.String())
+		}
+	}
+	interact("/like/3/5", "false")
+	interact("/save/3/5", "false")
+	interact("/like/3/1", "true")
+
+	get := func(path string, session int) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if session != 0 {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer dev-session-%d", session))
+		}
+		rr := serve(req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, body=%s", path, rr.Code, rr.Body.String())
+		}
+		return rr
+	}
+
+	var tweet models.TweetWithUser
+	if err := json.Unmarshal(get("/tweet/5", 3).Body.Bytes(), &tweet); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if tweet.Viewer == nil || *tweet.Viewer != (models.ViewerState{Liked: true, Saved: true}) {
+		t.Fatalf("viewer on /tweet/5 = %+v", tweet.Viewer)
+	}
+	if rr := get("/tweet/5", 0); strings.Contains(rr.Body.String(), `"viewer"`) {
+		t.Fatalf("anonymous payload has viewer state: %s", rr.Body.String())
+	}
+
+	for _, row := range decodePage(t, get("/home?mode=latest&limit=100", 3)).Data {
+		viewer, ok := row["viewer"].(map[string]any)
+		if !ok {
+			t.Fatalf("tweet %v has no viewer state", row["id"])
+		}
+		if want := row["id"].(float64) == 5; viewer["liked"] != want || viewer["saved"] != want || viewer["restacked"] != false {
+			t.Fatalf("viewer on tweet %v = %v", row["id"], viewer)
+		}
+	}
+
+	for _, row := range decodePage(t, get("/tweet/1/comments", 3)).Data {
+		viewer := row["viewer"].(map[string]any)
+		if want := row["id"].(float64) == 1; viewer["liked"] != want {
+			t.Fatalf("viewer on comment %v = %v", row["id"], viewer)
+		}
+	}
+}
+
+func TestSavedTweetsAndFolders(t *testing.T) {
+	useMemoryStore(t)
+	do := func(method, path, body string, session int) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer dev-session-%d", session))
+		return serve(req)
+	}
+	savedIDs := func(path string) []float64 {
+		t.Helper()
+		rr := do(http.MethodGet, path, "", 3)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, body=%s", path, rr.Code, rr.Body.String())
+		}
+		var ids []float64
+		for _, row := range decodePage(t, rr).Data {
+			ids = append(ids, row["id"].(float64))
+		}
+		return ids
+	}
+
+	for _, id := range []string{"5", "7", "9"} {
+		if rr := do(http.MethodPut, "/save/3/"+id, "", 3); rr.Code != http.StatusNoContent {
+			t.Fatalf("save %s: status = %d", id, rr.Code)
+		}
+	}
+	rr := do(http.MethodPost, "/user/3/folders", `{"name":" reading "}`, 3)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create folder: status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+	var folder models.BookmarkFolder
+	if err := json.Unmarshal(rr.Body.Bytes(), &folder); err != nil || folder.Name != "reading" {
+		t.Fatalf("folder = %+v, err %v", folder, err)
+	}
+	if rr := do(http.MethodPost, "/user/3/folders", `{"name":"reading"}`, 3); rr.Code != http.StatusConflict {
+		t.Fatalf("duplicate folder: status = %d", rr.Code)
+	}
+	folderQuery := "?folder=" + strconv.Itoa(folder.ID)
+	if rr := do(http.MethodPut, "/save/3/7"+folderQuery, "", 3); rr.Code != http.StatusNoContent {
+		t.Fatalf("file save: status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodPut, "/save/4/7"+folderQuery, "", 4); rr.Code != http.StatusNotFound {
+		t.Fatalf("file into someone else's folder: status = %d", rr.Code)
+	}
+	if rr := do(http.MethodPut, "/save/3/11?folder=999", "", 3); rr.Code != http.StatusNotFound {
+		t.Fatalf("file into a missing folder: status = %d", rr.Code)
+	}
+	// A failed filing leaves the tweet unsaved.
+	if rr := do(http.MethodGet, "/user/4/saved", "", 4); len(decodePage(t, rr).Data) != 0 {
+		t.Fatalf("user 4 saved %s", rr.Body.String())
+	}
+
+	if ids := savedIDs("/user/3/saved"); !slices.Equal(ids, []float64{9, 7, 5}) {
+		t.Fatalf("saved = %v, want [9 7 5]", ids)
+	}
+	if ids := savedIDs("/user/3/saved" + folderQuery); !slices.Equal(ids, []float64{7}) {
+		t.Fatalf("saved in folder = %v, want [7]", ids)
+	}
+	if rr := do(http.MethodGet, "/user/3/saved", "", 4); rr.Code != http.StatusForbidden {
+		t.Fatalf("someone else's saves: status = %d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/user/4/saved"+folderQuery, "", 4); rr.Code != http.StatusNotFound {
+		t.Fatalf("someone else's folder: status = %d", rr.Code)
+	}
+
+	if rr := do(http.MethodPut, "/save/3/7?remove=true", "", 3); rr.Code != http.StatusNoContent {
+		t.Fatalf("unsave: status = %d", rr.Code)
+	}
+	if ids := savedIDs("/user/3/saved" + folderQuery); len(ids) != 0 {
+		t.Fatalf("unsaved tweet still filed: %v", ids)
+	}
+	if rr := do(http.MethodDelete, "/user/3/folders/"+strconv.Itoa(folder.ID), "", 3); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete folder: status = %d", rr.Code)
+	}
+	if ids := savedIDs("/user/3/saved"); !slices.Equal(ids, []float64{9, 5}) {
+		t.Fatalf("saved after deleting folder = %v, want [9 5]", ids)
+	}
+}
+
+func TestLikedItemsListing(t *testing.T) {
+	useMemoryStore(t)
+	like := func(path, isComment string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, path, nil)
+		req.Header.Set("Authorization", "Bearer dev-session-3")
+		req.Header.Set("Is-Comment", isComment)
+		if rr := serve(req); rr.Code != http.StatusNoContent {
+			t.Fatalf("PUT %s: status = %d", path, rr.Code)
+		}
+	}
+	like("/like/3/5", "false")
+	like("/like/3/1", "true")
+	like("/like/3/7", "false")
+	like("/like/3/7?remove=true", "false")
+	like("/like/3/7", "false")
+
+	type entry struct {
+		kind string
+		id   float64
+	}
+	var got []entry
+	path := "/user/3/likes?limit=2"
+	for path != "" {
+		p := decodePage(t, serve(httptest.NewRequest(http.MethodGet, path, nil)))
+		for _, row := range p.Data {
+			body, _ := row[row["kind"].(string)].(map[string]any)
+			got = append(got, entry{row["kind"].(string), body["id"].(float64)})
+		}
+		path = ""
+		if p.NextCursor != nil {
+			path = "/user/3/likes?limit=2&cursor=" + *p.NextCursor
+		}
+	}
+	want := []entry{{"tweet", 7}, {"comment", 1}, {"tweet", 5}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("likes = %v, want %v", got, want)
+	}
+
+	rr := serve(httptest.NewRequest(http.MethodGet, "/v1/user/999/likes", nil))
+	if e := decodeError(t, rr); rr.Code != http.StatusNotFound || e.Message != "user not found" {
+		t.Fatalf("missing user: status = %d, error = %+v", rr.Code, e)
+	}
+}
+
+func TestInteractorListings(t *testing.T) {
+	useMemoryStore(t)
+	put := func(path string, session int, isComment string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, path, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer dev-session-%d", session))
+		req.Header.Set("Is-Comment", isComment)
+		if rr := serve(req); rr.Code != http.StatusNoContent {
+			t.Fatalf("PUT %s: status = %d", path, rr.Code)
+		}
+	}
+	userIDs := func(path string) []float64 {
+		t.Helper()
+		rr := serve(httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d", path, rr.Code)
+		}
+		var ids []float64
+		for _, row := range decodePage(t, rr).Data {
+			if row["username"] == nil || row["interacted_at"] == nil {
+				t.Fatalf("entry missing user fields: %v", row)
+			}
+			ids = append(ids, row["id"].(float64))
+		}
+		return ids
+	}
+
+	for _, u := range []int{2, 4, 3} {
+		put(fmt.Sprintf("/like/%d/5", u), u, "false")
+	}
+	put("/like/4/5?remove=true", 4, "false")
+	put("/restack/6/5", 6, "false")
+	put("/like/2/1", 2, "true")
+
+	if ids := userIDs("/tweet/5/likes"); !slices.Equal(ids, []float64{3, 2}) {
+		t.Fatalf("likers = %v, want [3 2]", ids)
+	}
+	if ids := userIDs("/tweet/5/likes?limit=1"); !slices.Equal(ids, []float64{3}) {
+		t.Fatalf("first page of likers = %v", ids)
+	}
+	if ids := userIDs("/tweet/5/restacks"); !slices.Equal(ids, []float64{6}) {
+		t.Fatalf("restackers = %v, want [6]", ids)
+	}
+	if ids := userIDs("/comment/1/likes"); !slices.Equal(ids, []float64{2}) {
+		t.Fatalf("comment likers = %v, want [2]", ids)
+	}
+	if ids := userIDs("/tweet/1/likes"); len(ids) != 0 {
+		t.Fatalf("comment like listed on its tweet: %v", ids)
+	}
+	if rr := serve(httptest.NewRequest(http.MethodGet, "/tweet/1000/likes", nil)); rr.Code != http.StatusNotFound {
+		t.Fatalf("missing tweet: status = %d", rr.Code)
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	q, err := store.ParseSearchQuery(`Fusion  "Energy research" from:@ana_sky after:2023-01-01 has:replies http://x`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	day := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !slices.Equal(q.Terms, []string{"fusion", "http", "x"}) || !slices.Equal(q.Phrases, []string{"energy research"}) ||
+		q.From != "ana_sky" || q.After == nil || !q.After.Equal(day) || q.Before != nil || !q.HasReplies {
+		t.Fatalf("query = %+v", q)
+	}
+	if q, err := store.ParseSearchQuery(`"unterminated phrase`); err != nil || !slices.Equal(q.Phrases, []string{"unterminated phrase"}) {
+		t.Fatalf("unterminated quote: %+v %v", q, err)
+	}
+	for _, bad := range []string{"", "   ", `""`, "before:yesterday", "has:likes"} {
+		if _, err := store.ParseSearchQuery(bad); err == nil {
+			t.Errorf("ParseSearchQuery(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	useMemoryStore(t)
+	search := func(query string) (resp struct {
+		Tweets     []models.TweetWithUser   `json:"tweets"`
+		Comments   []models.CommentWithUser `json:"comments"`
+		Users      []models.User            `json:"users"`
+		NextOffset *int                     `json:"next_offset"`
+	}) {
+		t.Helper()
+		rr := serve(httptest.NewRequest(http.MethodGet, "/search?"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("search %s: status = %d, body=%s", query, rr.Code, rr.Body.String())
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return resp
+	}
+	tweetIDs := func(tweets []models.TweetWithUser) []int {
+		var ids []int
+		for _, tw := range tweets {
+			ids = append(ids, tw.ID)
+		}
+		return ids
+	}
+
+	cases := map[string][]int{
+		"q=tech":              {84, 9, 16, 23, 1},
+		"q=from:ana_sky+tech": {9, 1},
+		"q=tech+after:2023-07-01+before:2024-01-01": {9, 16},
+		"q=tech+has:replies":                        {84, 16, 23, 1},
+		"q=%22fusion+energy%22":                     {7},
+		"q=%22energy+fusion%22":                     nil,
+	}
+	for query, want := range cases {
+		if got := tweetIDs(search(query).Tweets); !slices.Equal(got, want) {
+			t.Errorf("%s: tweets = %v, want %v", query, got, want)
+		}
+	}
+
+	first := search("q=tech&type=tweets&limit=2")
+	if got := tweetIDs(first.Tweets); !slices.Equal(got, []int{84, 9}) || first.NextOffset == nil || *first.NextOffset != 2 {
+		t.Fatalf("first page = %v, next %v", got, first.NextOffset)
+	}
+	if len(first.Comments) != 0 || len(first.Users) != 0 {
+		t.Fatalf("type=tweets returned other kinds: %+v", first)
+	}
+	last := search("q=tech&type=tweets&limit=2&offset=4")
+	if got := tweetIDs(last.Tweets); !slices.Equal(got, []int{1}) || last.NextOffset != nil {
+		t.Fatalf("last page = %v, next %v", got, last.NextOffset)
+	}
+
+	if users := search("q=lee").Users; len(users) != 1 || users[0].Username != "astro_lee" {
+		t.Fatalf("users = %+v", users)
+	}
+	if users := search("q=lee+from:astro_lee").Users; len(users) != 0 {
+		t.Fatalf("users matched a query with operators: %+v", users)
+	}
+	if comments := search("q=%22tweet+2%22&type=comments").Comments; len(comments) == 0 || comments[0].TweetID != 2 {
+		t.Fatalf("comments = %+v", comments)
+	}
+
+	for _, query := range []string{"", "q=", "q=before:soon", "q=x&type=posts", "q=x&offset=-1"} {
+		if rr := serve(httptest.NewRequest(http.MethodGet, "/search?"+query, nil)); rr.Code != http.StatusBadRequest {
+			t.Errorf("search %q: status = %d, want 400", query, rr.Code)
+		}
+	}
+}
+
+func TestExtractEntities(t *testing.T) {
+	got := models.ExtractEntities("Hi #Go! #123 a#b ##x #Crème_brûlée").Hashtags
+	want := []models.HashtagEntity{{Tag: "go", Start: 3, End: 6}, {Tag: "crème_brûlée", Start: 21, End: 34}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("hashtags = %+v, want %+v", got, want)
+	}
+	mentions := models.ExtractEntities("@Ana_Sky, mail a@b.io or @@x @").Mentions
+	if !slices.Equal(mentions, []models.MentionEntity{{Username: "ana_sky", Start: 0, End: 8}}) {
+		t.Fatalf("mentions = %+v", mentions)
+	}
+	for tag, want := range map[string]string{"#Go": "go", "space_2": "space_2", "12": "", "a b": "", "": ""} {
+		if got, ok := models.NormalizeHashtag(tag); got != want || ok != (want != "") {
+			t.Errorf("NormalizeHashtag(%q) = %q, %v", tag, got, ok)
+		}
+	}
+}
+
+func TestHashtagFeedAndEntities(t *testing.T) {
+	useMemoryStore(t)
+	write := func(method, path, body string) models.TweetWithUser {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer dev-session-2")
+		rr := serve(req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s %s: status = %d, body=%s", method, path, rr.Code, rr.Body.String())
+		}
+		var tw models.TweetWithUser
+		if err := json.Unmarshal(rr.Body.Bytes(), &tw); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return tw
+	}
+	tagged := func(path string) []int {
+		t.Helper()
+		rr := serve(httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d", path, rr.Code)
+		}
+		var ids []int
+		for _, row := range decodePage(t, rr).Data {
+			ids = append(ids, int(row["id"].(float64)))
+		}
+		return ids
+	}
+
+	created := write(http.MethodPost, "/tweet", `{"body":"Launch day #Space #NASA","is_comment":false}`)
+	want := []models.HashtagEntity{{Tag: "space", Start: 11, End: 17}, {Tag: "nasa", Start: 18, End: 23}}
+	if !slices.Equal(created.Entities.Hashtags, want) {
+		t.Fatalf("created entities = %+v", created.Entities)
+	}
+	older := write(http.MethodPost, "/tweet", `{"body":"#space is big","is_comment":false}`)
+
+	if ids := tagged("/hashtag/space"); !slices.Equal(ids, []int{older.ID, created.ID}) {
+		t.Fatalf("#space = %v", ids)
+	}
+	if ids := tagged("/hashtag/%23NASA"); !slices.Equal(ids, []int{created.ID}) {
+		t.Fatalf("#nasa = %v", ids)
+	}
+	if fetched := getTweet(t, created.ID); !slices.Equal(fetched.Entities.Hashtags, want) {
+		t.Fatalf("fetched entities = %+v", fetched.Entities)
+	}
+
+	edited := write(http.MethodPatch, "/tweet/"+strconv.Itoa(created.ID), `{"body":"Launch day #NASA"}`)
+	if len(edited.Entities.Hashtags) != 1 || edited.Entities.Hashtags[0].Tag != "nasa" {
+		t.Fatalf("edited entities = %+v", edited.Entities)
+	}
+	if ids := tagged("/hashtag/space"); !slices.Equal(ids, []int{older.ID}) {
+		t.Fatalf("#space after edit = %v", ids)
+	}
+	if rr := serve(httptest.NewRequest(http.MethodGet, "/hashtag/not-a-tag", nil)); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid tag: status = %d", rr.Code)
+	}
+}
+
+func TestMentions(t *testing.T) {
+	useMemoryStore(t)
+	post := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer dev-session-2")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		return serve(req)
+	}
+	mentioned := func(userID int) []string {
+		t.Helper()
+		rr := serve(httptest.NewRequest(http.MethodGet, "/user/"+strconv.Itoa(userID)+"/mentions", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("mentions: status = %d", rr.Code)
+		}
+		var kinds []string
+		for _, row := range decodePage(t, rr).Data {
+			kinds = append(kinds, row["kind"].(string))
+		}
+		return kinds
+	}
+
+	rr := post(http.MethodPost, "/tweet", `{"body":"Hi @nobody and @ana_sky","is_comment":false}`, nil)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "@nobody") {
+		t.Fatalf("unknown mention: status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = post(http.MethodPost, "/tweet", `{"body":"Launch with @Ana_Sky and @astro_lee, mail me@x.io","is_comment":false}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("create: status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+	var tweet models.TweetWithUser
+	if err := json.Unmarshal(rr.Body.Bytes(), &tweet); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := []models.MentionEntity{
+		{Username: "ana_sky", UserID: 1, Start: 12, End: 20},
+		{Username: "astro_lee", UserID: 10, Start: 25, End: 35},
+	}
+	if !slices.Equal(tweet.Entities.Mentions, want) {
+		t.Fatalf("mentions = %+v", tweet.Entities.Mentions)
+	}
+
+	rr = post(http.MethodPost, "/tweet", `{"body":"@ana_sky agreed","is_comment":true}`, map[string]string{"Parent-Tweet-ID": strconv.Itoa(tweet.ID)})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("comment: status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+	if kinds := mentioned(1); !slices.Equal(kinds, []string{"comment", "tweet"}) {
+		t.Fatalf("ana_sky mentions = %v", kinds)
+	}
+	if fetched := getTweet(t, tweet.ID); !slices.Equal(fetched.Entities.Mentions, want) {
+		t.Fatalf("fetched mentions = %+v", fetched.Entities.Mentions)
+	}
+
+	rr = post(http.MethodPatch, "/tweet/"+strconv.Itoa(tweet.ID), `{"body":"Launch with @astro_lee"}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("edit: status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+	if kinds := mentioned(1); !slices.Equal(kinds, []string{"comment"}) {
+		t.Fatalf("ana_sky mentions after edit = %v", kinds)
+	}
+	if kinds := mentioned(10); !slices.Equal(kinds, []string{"tweet"}) {
+		t.Fatalf("astro_lee mentions = %v", kinds)
+	}
+	if rr := post(http.MethodPatch, "/tweet/"+strconv.Itoa(tweet.ID), `{"body":"@ghost"}`, nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("edit with unknown mention: status = %d", rr.Code)
+	}
+	rr = serve(httptest.NewRequest(http.MethodGet, "/v1/user/999/mentions", nil))
+	if e := decodeError(t, rr); rr.Code != http.StatusNotFound || e.Message != "user not found" {
+		t.Fatalf("missing user: status = %d, error = %+v", rr.Code, e)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	useMemoryStore(t)
+	do := func(method, path string, as int, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer dev-session-"+strconv.Itoa(as))
+		req.Header.Set("Is-Comment", "false")
+		req.Header.Set("Parent-Tweet-ID", "1")
+		rr := serve(req)
+		if rr.Code >= 300 {
+			t.Fatalf("%s %s: status = %d, body=%s", method, path, rr.Code, rr.Body.String())
+		}
+		return rr
+	}
+	var resp struct {
+		Data        []models.Notification `json:"data"`
+		UnreadCount int                   `json:"unread_count"`
+	}
+	list := func() {
+		t.Helper()
+		resp.Data, resp.UnreadCount = nil, 0
+		if err := json.Unmarshal(do(http.MethodGet, "/notifications", 1, "").Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+	}
+
+	for _, liker := range []int{1, 2, 3, 4, 5} {
+		do(http.MethodPut, "/like/"+strconv.Itoa(liker)+"/1", liker, "")
+	}
+	do(http.MethodPut, "/follow/2/1", 2, "")
+	do(http.MethodPost, "/tweet", 3, `{"body":"Nice chip @ana_sky","is_comment":true}`)
+	do(http.MethodPut, "/like/2/1?remove=true", 2, "")
+
+	list()
+	var kinds []string
+	for _, n := range resp.Data {
+		kinds = append(kinds, n.Kind)
+	}
+	if !slices.Equal(kinds, []string{models.NotifyReply, models.NotifyMention, models.NotifyFollow, models.NotifyLike}) || resp.UnreadCount != 4 {
+		t.Fatalf("notifications = %v, unread = %d", kinds, resp.UnreadCount)
+	}
+	like := resp.Data[3]
+	if like.ActorCount != 3 || len(like.Actors) != 3 || like.Actors[0].ID != 5 || like.Tweet == nil || like.Tweet.ID != 1 {
+		t.Fatalf("like notification = %+v", like)
+	}
+	if like.Summary != "Tom Miles and 2 others liked your tweet" {
+		t.Fatalf("summary = %q", like.Summary)
+	}
+	if s := resp.Data[2].Summary; s != "Tony Sparks followed you" {
+		t.Fatalf("follow summary = %q", s)
+	}
+	if c := resp.Data[1].Comment; c == nil || c.UserID != 3 {
+		t.Fatalf("mention notification = %+v", resp.Data[1])
+	}
+
+	if rr := do(http.MethodPost, "/notifications/read", 1, `{"ids":[`+strconv.Itoa(like.ID)+`]}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("mark read: status = %d", rr.Code)
+	}
+	do(http.MethodPut, "/like/6/1", 6, "")
+	list()
+	if resp.UnreadCount != 4 || resp.Data[0].Kind != models.NotifyLike || resp.Data[0].ActorCount != 1 || resp.Data[0].Read {
+		t.Fatalf("after new like: unread = %d, first = %+v", resp.UnreadCount, resp.Data[0])
+	}
+	if !resp.Data[len(resp.Data)-1].Read {
+		t.Fatalf("read notification = %+v", resp.Data[len(resp.Data)-1])
+	}
+
+	do(http.MethodPost, "/notifications/read", 1, "")
+	list()
+	if resp.UnreadCount != 0 {
+		t.Fatalf("unread after marking all read = %d", resp.UnreadCount)
+	}
+	if rr := serve(httptest.NewRequest(http.MethodGet, "/notifications", nil)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous: status = %d", rr.Code)
+	}
+}
+
+// sseEvent is one event read from a text/event-stream.
+type sseEvent struct {
+	ID   string
+	Type string
+	Data string
+}
+
+// openStream connects to the event stream at path and returns its events.
+func openStream(t *testing.T, srv *httptest.Server, path string, header http.Header) <-chan sseEvent {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream: status = %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		var e sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			field, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch field {
+			case "id":
+				e.ID = value
+			case "event":
+				e.Type = value
+			case "data":
+				e.Data = value
+			case "":
+				if e.Type != "" {
+					events <- e
+				}
+				e = sseEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event")
+	}
+	return sseEvent{}
+}
+
+func TestEventStream(t *testing.T) {
+	useMemoryStore(t)
+	srv := httptest.NewServer(api.Authenticate(http.DefaultServeMux))
+	t.Cleanup(srv.Close)
+	act := func(method, path, body string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer dev-session-2")
+		req.Header.Set("Is-Comment", "false")
+		req.Header.Set("Parent-Tweet-ID", "1")
+		if rr := serve(req); rr.Code >= 300 {
+			t.Fatalf("%s %s: status = %d, body=%s", method, path, rr.Code, rr.Body.String())
+		}
+	}
+
+	anon := openStream(t, srv, "/events", nil)
+	act(http.MethodPost, "/tweet", `{"body":"live #now","is_comment":false}`)
+	created := nextEvent(t, anon)
+	var tweet models.TweetWithUser
+	if err := json.Unmarshal([]byte(created.Data), &tweet); created.Type != "tweet" || err != nil || tweet.Body != "live #now" || len(tweet.Entities.Hashtags) != 1 {
+		t.Fatalf("tweet event = %+v", created)
+	}
+
+	// Removing a like that was never there, or liking twice, changes
+	// nothing and publishes nothing.
+	act(http.MethodPut, "/like/2/1?remove=true", "")
+	act(http.MethodPut, "/save/2/1", "")
+	act(http.MethodPut, "/like/2/1", "")
+	act(http.MethodPut, "/like/2/1", "")
+	act(http.MethodPost, "/tweet", `{"body":"first","is_comment":true}`)
+	if e := nextEvent(t, anon); e.Type != "interaction" || !strings.Contains(e.Data, `"kind":"like"`) || !strings.Contains(e.Data, `"count":211`) {
+		t.Fatalf("like event = %+v", e)
+	}
+	if e := nextEvent(t, anon); e.Type != "comment" || !strings.Contains(e.Data, `"body":"first"`) {
+		t.Fatalf("comment event = %+v", e)
+	}
+	if e := nextEvent(t, anon); e.Type != "comment_count" || e.Data != `{"tweet_id":1,"comments":4,"replies":1}` {
+		t.Fatalf("comment count event = %+v", e)
+	}
+
+	replay := openStream(t, srv, "/events", http.Header{
+		"Last-Event-Id": {created.ID},
+		"Authorization": {"Bearer dev-session-2"},
+	})
+	var kinds []string
+	for range 4 {
+		e := nextEvent(t, replay)
+		var data struct {
+			Kind string `json:"kind"`
+		}
+		_ = json.Unmarshal([]byte(e.Data), &data)
+		kinds = append(kinds, e.Type+":"+data.Kind)
+	}
+	if !slices.Equal(kinds, []string{"interaction:save", "interaction:like", "comment:", "comment_count:"}) {
+		t.Fatalf("replayed = %v", kinds)
+	}
+
+	if e := nextEvent(t, openStream(t, srv, "/events?last_event_id=999999999", nil)); e.Type != "reset" {
+		t.Fatalf("stale id: event = %+v", e)
+	}
+	if rr := serve(httptest.NewRequest(http.MethodGet, "/events?last_event_id=x", nil)); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid id: status = %d", rr.Code)
+	}
+}
+
+// socketMessage is a message read from the WebSocket gateway.
+type socketMessage struct {
+	Type  string          `json:"type"`
+	ID    int64           `json:"id"`
+	Data  json.RawMessage `json:"data"`
+	Error string          `json:"error"`
+}
+
+// socketRoundTrip sends req on conn and returns the next message.
+func socketRoundTrip(t *testing.T, conn *websocket.Conn, req string) socketMessage {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return nextSocketMessage(t, conn)
+}
+
+// nextSocketMessage returns the next message on conn, failing after two
+// seconds.
+func nextSocketMessage(t *testing.T, conn *websocket.Conn) socketMessage {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg socketMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+func TestSocketGateway(t *testing.T) {
+	useMemoryStore(t)
+	srv := httptest.NewServer(api.Authenticate(http.DefaultServeMux))
+	t.Cleanup(srv.Close)
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v (response %+v)", err, resp)
+	}
+	t.Cleanup(func() { conn.Close() })
+	act := func(method, path, body, session string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer dev-session-"+session)
+		req.Header.Set("Is-Comment", "false")
+		req.Header.Set("Parent-Tweet-ID", "1")
+		if rr := serve(req); rr.Code >= 300 {
+			t.Fatalf("%s %s: status = %d, body=%s", method, path, rr.Code, rr.Body.String())
+		}
+	}
+
+	if msg := socketRoundTrip(t, conn, `{"action":"subscribe","tweet_ids":[1,1],"user_ids":[3]}`); msg.Type != "subscribed" || string(msg.Data) != `{"tweet_ids":[1],"user_ids":[3]}` {
+		t.Fatalf("subscribe = %+v", msg)
+	}
+
+	// Only events about tweet 1 or by user 3 come through.
+	act(http.MethodPut, "/like/2/2", "", "2")
+	act(http.MethodPost, "/tweet", `{"body":"not followed","is_comment":false}`, "2")
+	act(http.MethodPost, "/tweet", `{"body":"live reply","is_comment":true}`, "2")
+	if msg := nextSocketMessage(t, conn); msg.Type != "comment" || !strings.Contains(string(msg.Data), `"body":"live reply"`) {
+		t.Fatalf("comment = %+v", msg)
+	}
+	if msg := nextSocketMessage(t, conn); msg.Type != "comment_count" || string(msg.Data) != `{"tweet_id":1,"comments":4,"replies":1}` {
+		t.Fatalf("comment count = %+v", msg)
+	}
+	act(http.MethodPut, "/like/2/1", "", "2")
+	if msg := nextSocketMessage(t, conn); msg.Type != "interaction" || !strings.Contains(string(msg.Data), `"count":211`) {
+		t.Fatalf("like = %+v", msg)
+	}
+	act(http.MethodPost, "/tweet", `{"body":"from gale","is_comment":false}`, "3")
+	if msg := nextSocketMessage(t, conn); msg.Type != "tweet" || !strings.Contains(string(msg.Data), `"body":"from gale"`) {
+		t.Fatalf("followed user's tweet = %+v", msg)
+	}
+
+	if msg := socketRoundTrip(t, conn, `{"action":"unsubscribe","tweet_ids":[1]}`); string(msg.Data) != `{"tweet_ids":[],"user_ids":[3]}` {
+		t.Fatalf("unsubscribe = %+v", msg)
+	}
+	ids := make([]string, 50)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i + 100)
+	}
+	if msg := socketRoundTrip(t, conn, `{"action":"subscribe","tweet_ids":[`+strings.Join(ids, ",")+`]}`); msg.Type != "error" || !strings.Contains(msg.Error, "at most 50") {
+		t.Fatalf("over the cap = %+v", msg)
+	}
+	if msg := socketRoundTrip(t, conn, `{"action":"subscribe","tweet_ids":[0]}`); msg.Type != "error" {
+		t.Fatalf("invalid id = %+v", msg)
+	}
+	if msg := socketRoundTrip(t, conn, `{"action":"watch"}`); msg.Type != "error" {
+		t.Fatalf("unknown action = %+v", msg)
+	}
+	if msg := socketRoundTrip(t, conn, `not json`); msg.Type != "error" || msg.Error != "invalid message" {
+		t.Fatalf("invalid message = %+v", msg)
+	}
+
+	// Browsers sign in with the access_token query parameter, and then hear
+	// of their own saves.
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL+"?access_token=bogus", nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("bad token: err %v, response %+v", err, resp)
+	}
+	own, resp, err := websocket.DefaultDialer.Dial(wsURL+"?access_token=dev-session-2", nil)
+	if err != nil {
+		t.Fatalf("dial with token: %v (response %+v)", err, resp)
+	}
+	t.Cleanup(func() { own.Close() })
+	if msg := socketRoundTrip(t, own, `{"action":"subscribe","tweet_ids":[5]}`); msg.Type != "subscribed" {
+		t.Fatalf("subscribe = %+v", msg)
+	}
+	act(http.MethodPut, "/save/2/5", "", "2")
+	if msg := nextSocketMessage(t, own); msg.Type != "interaction" || !strings.Contains(string(msg.Data), `"kind":"save"`) {
+		t.Fatalf("own save = %+v", msg)
+	}
+
+	rr := serve(httptest.NewRequest(http.MethodGet, "/ws", nil))
+	if e := decodeError(t, rr); rr.Code != http.StatusBadRequest || e.Code != "validation_failed" {
+		t.Fatalf("plain request: status = %d, error = %+v", rr.Code, e)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	useMemoryStore(t)
+	for _, path := range []string{"/tweet/1", "/v1/tweet/1"} {
+		rr := serve(httptest.NewRequest(http.MethodGet, path, nil))
+		var tweet models.TweetWithUser
+		if err := json.Unmarshal(rr.Body.Bytes(), &tweet); rr.Code != http.StatusOK || err != nil || tweet.ID != 1 {
+			t.Fatalf("GET %s: status = %d, body=%s", path, rr.Code, rr.Body.String())
+		}
+	}
+
+	for _, tc := range []struct {
+		method, path, allow string
+	}{
+		{http.MethodPost, "/v1/tweet/1", "DELETE, GET, HEAD, PATCH"},
+		{http.MethodGet, "/v1/like/1/1", "PUT"},
+		{http.MethodDelete, "/user/1", "GET, HEAD"},
+		{http.MethodGet, "/v1/notifications/read", "POST"},
+	} {
+		rr := serve(httptest.NewRequest(tc.method, tc.path, nil))
+		if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != tc.allow {
+			t.Errorf("%s %s: status = %d, Allow = %q, want 405 and %q", tc.method, tc.path, rr.Code, rr.Header().Get("Allow"), tc.allow)
+		}
+	}
+
+	for _, tc := range []struct {
+		path, message string
+	}{
+		{"/v1/tweet/abc", "invalid tweet id"},
+		{"/comment/x/replies", "invalid comment id"},
+		{"/v1/user/me/followers", "invalid user id"},
+	} {
+		rr := serve(httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if e := decodeError(t, rr); rr.Code != http.StatusBadRequest || e.Code != "validation_failed" || e.Message != tc.message {
+			t.Errorf("GET %s: status = %d, error = %+v", tc.path, rr.Code, e)
+		}
+	}
+
+	for _, path := range []string{"/v1/tweet/1/nothing", "/v2/tweet/1", "/v1/user"} {
+		if rr := serve(httptest.NewRequest(http.MethodGet, path, nil)); rr.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status = %d", path, rr.Code)
+		}
+	}
+}
+
+// apiError is the error object of an error response.
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// decodeError decodes the error envelope of rr.
+func decodeError(t *testing.T, rr *httptest.ResponseRecorder) apiError {
+	t.Helper()
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("error content type = %q, body=%s", ct, rr.Body.String())
+	}
+	var body struct {
+		Error apiError `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode error: %v, body=%s", err, rr.Body.String())
+	}
+	return body.Error
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	useMemoryStore(t)
+	do := func(method, path, body string, userID int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if userID != 0 {
+			req.Header.Set("Authorization", "Bearer dev-session-"+strconv.Itoa(userID))
+		}
+		return serve(req)
+	}
+	for _, tc := range []struct {
+		name      string
+		rr        *httptest.ResponseRecorder
+		status    int
+		code, msg string
+	}{
+		{"missing tweet", do(http.MethodGet, "/v1/tweet/1000", "", 0), http.StatusNotFound, "not_found", "tweet not found"},
+		{"missing comment", do(http.MethodGet, "/v1/comment/1000/replies", "", 0), http.StatusNotFound, "not_found", "comment not found"},
+		{"anonymous", do(http.MethodPost, "/v1/tweet", `{"body":"hi"}`, 0), http.StatusUnauthorized, "unauthorized", "missing authorization"},
+		{"other user", do(http.MethodGet, "/v1/user/2/saved", "", 1), http.StatusForbidden, "forbidden", "the path names another user"},
+		{"not the author", do(http.MethodDelete, "/v1/tweet/1", "", 2), http.StatusForbidden, "forbidden", "only the author can delete a tweet"},
+		{"bad body", do(http.MethodPost, "/v1/tweet", `{"body":`, 1), http.StatusBadRequest, "validation_failed", "invalid JSON body"},
+		{"bad limit", do(http.MethodGet, "/v1/home?limit=0", "", 0), http.StatusBadRequest, "validation_failed", "limit must be between 1 and 100"},
+		{"no route", do(http.MethodGet, "/v1/nothing", "", 0), http.StatusNotFound, "not_found", "no such route"},
+		{"wrong method", do(http.MethodPut, "/v1/home", "", 0), http.StatusMethodNotAllowed, "method_not_allowed", "PUT is not allowed here"},
+	} {
+		if e := decodeError(t, tc.rr); tc.rr.Code != tc.status || e.Code != tc.code || e.Message != tc.msg {
+			t.Errorf("%s: status = %d, error = %+v; want %d %s %q", tc.name, tc.rr.Code, e, tc.status, tc.code, tc.msg)
+		}
+	}
+
+	if rr := do(http.MethodPost, "/v1/user/1/folders", `{"name":"Dup"}`, 1); rr.Code != http.StatusCreated {
+		t.Fatalf("create folder: status = %d", rr.Code)
+	}
+	rr := do(http.MethodPost, "/v1/user/1/folders", `{"name":"Dup"}`, 1)
+	if e := decodeError(t, rr); rr.Code != http.StatusConflict || e.Code != "conflict" {
+		t.Fatalf("duplicate folder: status = %d, error = %+v", rr.Code, e)
+	}
+}
+
+func TestErrorEnvelopeHidesPostgRESTErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/v1/tweets", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("id") == "eq.7" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			_, _ = w.Write([]byte(`{"code":"PGRST116","message":"JSON object requested, multiple (or no) rows returned","details":"The result contains 0 rows"}`))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"code":"42P01","message":"relation \"public.tweets\" does not exist"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	setSupabaseEnv(srv.URL)
+	api.ResetSupabaseForTests()
+
+	rr := serve(httptest.NewRequest(http.MethodGet, "/v1/tweet/7", nil))
+	if e := decodeError(t, rr); rr.Code != http.StatusNotFound || e.Code != "not_found" {
+		t.Fatalf("no row: status = %d, error = %+v", rr.Code, e)
+	}
+	rr = serve(httptest.NewRequest(http.MethodGet, "/v1/home?mode=latest", nil))
+	e := decodeError(t, rr)
+	if rr.Code != http.StatusInternalServerError || e.Code != "internal" || strings.Contains(rr.Body.String(), "relation") {
+		t.Fatalf("database error: status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestPostgRESTRemovalKeepsCommentInteractions(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	client, err := supabase.NewClient(srv.URL, "test-key", nil)
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	st := store.NewPostgREST(client, client)
+
+	if _, err := st.SetInteraction(context.Background(), 1, store.Target{ID: 5}, store.Like, false); err != nil {
+		t.Fatalf("unlike tweet: %v", err)
+	}
+	if query.Get("tweet_id") != "eq.5" || query.Get("comment_id") != "is.null" {
+		t.Fatalf("unlike tweet filters = %v", query)
+	}
+	if _, err := st.SetInteraction(context.Background(), 1, store.Target{ID: 5, IsComment: true}, store.Like, false); err != nil {
+		t.Fatalf("unlike comment: %v", err)
+	}
+	if query.Get("comment_id") != "eq.5" || query.Has("tweet_id") {
+		t.Fatalf("unlike comment filters = %v", query)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	useMemoryStore(t)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer dev-session-1")
+		req.Header.Set("Parent-Tweet-ID", "1")
+		return serve(req)
+	}
+	post := func(body string) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(map[string]any{"body": body, "is_comment": false})
+		return do(http.MethodPost, "/v1/tweet", string(raw))
+	}
+	fieldsOf := func(rr *httptest.ResponseRecorder) string {
+		t.Helper()
+		var body struct {
+			Error struct {
+				Code   string `json:"code"`
+				Fields []struct {
+					Field string `json:"field"`
+					Code  string `json:"code"`
+				} `json:"fields"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || rr.Code != http.StatusBadRequest || body.Error.Code != "validation_failed" {
+			t.Fatalf("status = %d, body=%s", rr.Code, rr.Body.String())
+		}
+		var out []string
+		for _, f := range body.Error.Fields {
+			out = append(out, f.Field+":"+f.Code)
+		}
+		return strings.Join(out, ",")
+	}
+
+	for _, body := range []string{"", " \n\t", "\u200b\u2060"} {
+		if got := fieldsOf(post(body)); got != "body:required" {
+			t.Errorf("body %q: fields = %s", body, got)
+		}
+	}
+	if got := fieldsOf(post(strings.Repeat("a", 281))); got != "body:too_long" {
+		t.Errorf("281 letters: fields = %s", got)
+	}
+	if got := fieldsOf(do(http.MethodPost, "/v1/tweet", `{"body":"","is_comment":true}`)); got != "body:required" {
+		t.Errorf("blank comment: fields = %s", got)
+	}
+	if got := fieldsOf(do(http.MethodPatch, "/v1/tweet/1", `{"body":"   "}`)); got != "body:required" {
+		t.Errorf("blank edit: fields = %s", got)
+	}
+
+	// A family emoji is several code points but one character.
+	if rr := post(strings.Repeat("\U0001F468\u200d\U0001F469\u200d\U0001F467", 280)); rr.Code != http.StatusOK {
+		t.Fatalf("280 emoji: status = %d, body=%s", rr.Code, rr.Body.String())
+	}
+	rr := post("Cafe\u0301")
+	var tweet models.Tweet
+	if err := json.Unmarshal(rr.Body.Bytes(), &tweet); err != nil || tweet.Body != "Caf\u00e9" {
+		t.Fatalf("normalized body = %q, status = %d", tweet.Body, rr.Code)
+	}
+
+	t.Setenv("MAX_BODY_LENGTH", "5")
+	if got := fieldsOf(post("123456")); got != "body:too_long" {
+		t.Errorf("configured limit: fields = %s", got)
+	}
+	if rr := post("12345"); rr.Code != http.StatusOK {
+		t.Errorf("at configured limit: status = %d", rr.Code)
+	}
+
+	if got := fieldsOf(do(http.MethodPost, "/v1/user/1/bio", `{"bio":"`+strings.Repeat("b", 161)+`"}`)); got != "bio:too_long" {
+		t.Errorf("long bio: fields = %s", got)
+	}
+	if rr := do(http.MethodPost, "/v1/user/1/bio", `{"bio":"`+strings.Repeat("b", 160)+`"}`); rr.Code != http.StatusNoContent {
+		t.Errorf("160 letter bio: status = %d", rr.Code)
+	}
+	if got := fieldsOf(do(http.MethodPost, "/v1/user/1/folders", `{"name":" "}`)); got != "name:required" {
+		t.Errorf("blank folder name: fields = %s", got)
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// BookmarkFolder is a named folder a user files saved tweets into.
+// Mirrors table public.bookmark_folders.
+type BookmarkFolder struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SavedTweet is a tweet in a user's saved listing. SavedAt is when it was
+// saved and FolderID the folder it is filed in, if any.
+type SavedTweet struct {
+	TweetWithUser
+	SavedAt  time.Time `json:"saved_at"`
+	FolderID *int      `json:"folder_id"`
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Entities are the linkable spans of a tweet or comment body. Offsets count
+// Unicode code points from the start of the body; End is exclusive.
+type Entities struct {
+	Hashtags []HashtagEntity `json:"hashtags"`
+	Mentions []MentionEntity `json:"mentions"`
+}
+
+// HashtagEntity is a "#tag" in a body. Tag is the lowercased text after the
+// "#", and the span covers the "#".
+type HashtagEntity struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// MentionEntity is an "@username" in a body, and the span covers the "@".
+// ExtractEntities sets Username to the lowercased text after the "@"; once the
+// mention is resolved it holds the user's own username and UserID their id.
+type MentionEntity struct {
+	Username string `json:"username"`
+	UserID   int    `json:"user_id"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_'
+}
+
+// ExtractEntities finds the hashtags and mentions in body. A hashtag is a "#"
+// that does not follow a word character or another "#", then a run of
+// letters, digits and underscores holding at least one letter. A mention is
+// an "@" that does not follow a word character or another "@", then a run of
+// letters, digits and underscores. sql/hashtags.sql and sql/mentions.sql
+// index bodies by the same rules. Mentions are left unresolved.
+func ExtractEntities(body string) Entities {
+	e := Entities{Hashtags: []HashtagEntity{}, Mentions: []MentionEntity{}}
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		sigil := runes[i]
+		if (sigil != '#' && sigil != '@') || (i > 0 && (isWordRune(runes[i-1]) || runes[i-1] == sigil)) {
+			continue
+		}
+		end := i + 1
+		letter := false
+		for end < len(runes) && isWordRune(runes[end]) {
+			letter = letter || unicode.IsLetter(runes[end])
+			end++
+		}
+		text := strings.ToLower(string(runes[i+1 : end]))
+		switch {
+		case sigil == '#' && letter:
+			e.Hashtags = append(e.Hashtags, HashtagEntity{Tag: text, Start: i, End: end})
+		case sigil == '@' && end > i+1:
+			e.Mentions = append(e.Mentions, MentionEntity{Username: text, Start: i, End: end})
+		}
+		i = end - 1
+	}
+	return e
+}
+
+// MentionedUsernames returns the distinct lowercased usernames mentioned in
+// body, in order of first mention.
+func MentionedUsernames(body string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range ExtractEntities(body).Mentions {
+		if !seen[m.Username] {
+			seen[m.Username] = true
+			names = append(names, m.Username)
+		}
+	}
+	return names
+}
+
+// NormalizeHashtag returns the indexed form of a tag given with or without
+// its "#", or false when it is not a valid hashtag.
+func NormalizeHashtag(tag string) (string, bool) {
+	tag = strings.TrimPrefix(tag, "#")
+	h := ExtractEntities("#" + tag).Hashtags
+	if len(h) != 1 || h[0].End != len([]rune(tag))+1 {
+		return "", false
+	}
+	return h[0].Tag, true
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Liked item kinds.
+const (
+	LikedTweet   = "tweet"
+	LikedComment = "comment"
+)
+
+// LikedItem is an entry in a user's likes: a tweet when Kind is LikedTweet
+// and a comment when it is LikedComment. ID is the id of the like and LikedAt
+// when it was recorded.
+type LikedItem struct {
+	ID      int              `json:"id"`
+	Kind    string           `json:"kind"`
+	Tweet   *TweetWithUser   `json:"tweet,omitempty"`
+	Comment *CommentWithUser `json:"comment,omitempty"`
+	LikedAt time.Time        `json:"liked_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Mention item kinds.
+const (
+	MentionTweet   = "tweet"
+	MentionComment = "comment"
+)
+
+// Mention records that a tweet or comment mentions a user. CreatedAt is when
+// the mention was first written, which is later than the tweet or comment when
+// an edit added it. Mirrors table public.mentions.
+type Mention struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	TweetID   *int      `json:"tweet_id"`
+	CommentID *int      `json:"comment_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MentionItem is an entry in a user's mentions: a tweet when Kind is
+// MentionTweet and a comment when it is MentionComment. ID is the id of the
+// mention.
+type MentionItem struct {
+	ID          int              `json:"id"`
+	Kind        string           `json:"kind"`
+	Tweet       *TweetWithUser   `json:"tweet,omitempty"`
+	Comment     *CommentWithUser `json:"comment,omitempty"`
+	MentionedAt time.Time        `json:"mentioned_at"`
+}
@@ -20,19 +20,21 @@ type Tweet struct {
 	Saves        int       `json:"saves"`
 	Restacks     int       `json:"restacks"`
 	Replies      int       `json:"replies"`
+	Comments     int       `json:"comments"`
 	IsEdited     bool      `json:"is_edited"`
 	CreatedAt    time.Time `json:"created_at"`
 	LastEditedAt time.Time `json:"last_edited_at"`
 }
 
 type Comment struct {
-	ID           int       `json:"id"`
-	UserID       int       `json:"user_id"`
-	TweetID      int       `json:"tweet_id"`
-	Body         string    `json:"body"`
-	Likes        int       `json:"likes"`
-	Replies      int       `json:"replies"`
-	IsEdited     bool      `json:"is_edited"`
-	LastEditedAt time.Time `json:"last_edited_at"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID              int       `json:"id"`
+	UserID          int       `json:"user_id"`
+	TweetID         int       `json:"tweet_id"`
+	ParentCommentID *int      `json:"parent_comment_id"`
+	Body            string    `json:"body"`
+	Likes           int       `json:"likes"`
+	Replies         int       `json:"replies"`
+	IsEdited        bool      `json:"is_edited"`
+	LastEditedAt    time.Time `json:"last_edited_at"`
+	CreatedAt       time.Time `json:"created_at"`
 }
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Notification kinds.
+const (
+	NotifyLike    = "like"
+	NotifyRestack = "restack"
+	NotifyReply   = "reply"
+	NotifyFollow  = "follow"
+	NotifyMention = "mention"
+)
+
+// Notification tells a user what others did to their tweets, comments and
+// profile. Events of one kind on one target gather into a single notification
+// until it is read. Actors holds the latest few of them, most recent first,
+// and ActorCount counts them all. The target is the liked, restacked or
+// replied-to tweet or comment, the mentioning one for NotifyMention, and
+// absent for NotifyFollow. Summary reads like "Ana and 4 others liked your
+// tweet". UpdatedAt is when the last actor joined.
+type Notification struct {
+	ID         int              `json:"id"`
+	Kind       string           `json:"kind"`
+	Actors     []User           `json:"actors"`
+	ActorCount int              `json:"actor_count"`
+	Tweet      *TweetWithUser   `json:"tweet,omitempty"`
+	Comment    *CommentWithUser `json:"comment,omitempty"`
+	Summary    string           `json:"summary"`
+	Read       bool             `json:"read"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
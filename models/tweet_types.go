@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// ViewerState is the authenticated viewer's own interactions with a tweet or
+// comment.
+type ViewerState struct {
+	Liked     bool `json:"liked"`
+	Saved     bool `json:"saved"`
+	Restacked bool `json:"restacked"`
+}
+
+// TweetWithUser combines tweet data with its author. Entities are filled in
+// by the handlers from Body; Viewer is set only on authenticated requests.
+type TweetWithUser struct {
+	Tweet
+	User     User         `json:"users"`
+	Entities Entities     `json:"entities"`
+	Viewer   *ViewerState `json:"viewer,omitempty"`
+}
+
+// CommentWithUser combines comment data with its author. Entities are filled
+// in by the handlers from Body; Viewer is set only on authenticated requests.
+type CommentWithUser struct {
+	Comment
+	User     User         `json:"users"`
+	Entities Entities     `json:"entities"`
+	Viewer   *ViewerState `json:"viewer,omitempty"`
+}
+
+// Feed item kinds.
+const (
+	FeedTweet   = "tweet"
+	FeedRestack = "restack"
+)
+
+// CommentThread is a comment with the replies beneath it, oldest first.
+// Children is cut off at a depth limit; Replies still counts every direct
+// reply.
+type CommentThread struct {
+	CommentWithUser
+	Children []CommentThread `json:"children"`
+}
+
+// FeedItem is a tweet as it appears in a timeline. Kind is FeedRestack when
+// the entry is RestackedBy's restack of the tweet and FeedTweet otherwise.
+// FeedAt is when it entered the timeline: the tweet's creation time or the
+// restack time.
+type FeedItem struct {
+	TweetWithUser
+	Kind        string    `json:"kind"`
+	RestackedBy *User     `json:"restacked_by"`
+	FeedAt      time.Time `json:"feed_at"`
+}
+
+// Revision is a prior version of an edited tweet or comment. CreatedAt is when
+// the version was replaced. Mirrors table public.edit_history.
+type Revision struct {
+	ID        int       `json:"id"`
+	TweetID   *int      `json:"tweet_id"`
+	CommentID *int      `json:"comment_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
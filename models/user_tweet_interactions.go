@@ -5,12 +5,16 @@ import "time"
 // UserTweetInteraction represents per-user interactions with a tweet.
 // Mirrors table public.user_tweet_interactions.
 type UserTweetInteraction struct {
-	ID          int       `json:"id"`
-	UserID      int       `json:"user_id"`
-	TweetID     *int      `json:"tweet_id"`
-	CommentID   *int      `json:"comment_id"`
-	IsSaved     bool      `json:"is_saved"`
-	IsLiked     bool      `json:"is_liked"`
-	IsRestacked bool      `json:"is_restacked"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	TweetID     *int       `json:"tweet_id"`
+	CommentID   *int       `json:"comment_id"`
+	IsSaved     bool       `json:"is_saved"`
+	IsLiked     bool       `json:"is_liked"`
+	IsRestacked bool       `json:"is_restacked"`
+	LikedAt     *time.Time `json:"liked_at"`
+	RestackedAt *time.Time `json:"restacked_at"`
+	SavedAt     *time.Time `json:"saved_at"`
+	FolderID    *int       `json:"folder_id"`
+	CreatedAt   time.Time  `json:"created_at"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Profile is a user with their follow graph counts.
+type Profile struct {
+	User
+	Followers int `json:"followers"`
+	Following int `json:"following"`
+}
+
+// InteractionEntry is a user in a listing of who liked or restacked a tweet
+// or comment. InteractedAt is when they did.
+type InteractionEntry struct {
+	User
+	InteractedAt time.Time `json:"interacted_at"`
+}
+
+// FollowEntry is a user in a follower or following listing. FollowedAt is
+// when the follow was recorded.
+type FollowEntry struct {
+	User
+	FollowedAt time.Time `json:"followed_at"`
+}
@@ -0,0 +1,25 @@
+-- Bookmarks
+-- Stamps saves with the time they happened so saved tweets list in the order
+-- they were saved. Apply after schema.sql.
+
+-- Set saved_at whenever is_saved turns on. Undoing a save clears saved_at and
+-- takes the tweet out of its folder.
+CREATE OR REPLACE FUNCTION public.stamp_saved_at()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF NEW.is_saved AND (TG_OP = 'INSERT' OR NOT OLD.is_saved) THEN
+    NEW.saved_at := NOW();
+  ELSIF NOT NEW.is_saved THEN
+    NEW.saved_at := NULL;
+    NEW.folder_id := NULL;
+  END IF;
+  RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS on_save_changed ON public.user_tweet_interactions;
+CREATE TRIGGER on_save_changed
+BEFORE INSERT OR UPDATE OF is_saved ON public.user_tweet_interactions
+FOR EACH ROW EXECUTE PROCEDURE public.stamp_saved_at();
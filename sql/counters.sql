@@ -0,0 +1,143 @@
+-- Counter maintenance for tweets and comments
+-- Keeps tweets.likes/saves/restacks/comments/replies and
+-- comments.likes/replies in sync with user_tweet_interactions and comments.
+-- Apply after schema.sql.
+
+-- Apply a like/save/restack delta to the target of an interaction row.
+-- A row with a comment_id targets the comment; otherwise it targets tweet_id.
+CREATE OR REPLACE FUNCTION public.apply_interaction_delta(
+  target_tweet_id integer,
+  target_comment_id integer,
+  d_likes integer,
+  d_saves integer,
+  d_restacks integer
+) RETURNS void
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF target_comment_id IS NOT NULL THEN
+    IF d_likes <> 0 THEN
+      UPDATE public.comments SET likes = likes + d_likes WHERE id = target_comment_id;
+    END IF;
+  ELSIF target_tweet_id IS NOT NULL THEN
+    IF d_likes <> 0 OR d_saves <> 0 OR d_restacks <> 0 THEN
+      UPDATE public.tweets
+      SET likes = likes + d_likes,
+          saves = saves + d_saves,
+          restacks = restacks + d_restacks
+      WHERE id = target_tweet_id;
+    END IF;
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.sync_interaction_counters()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF TG_OP IN ('UPDATE', 'DELETE') THEN
+    PERFORM public.apply_interaction_delta(
+      OLD.tweet_id, OLD.comment_id,
+      -OLD.is_liked::integer, -OLD.is_saved::integer, -OLD.is_restacked::integer);
+  END IF;
+  IF TG_OP IN ('INSERT', 'UPDATE') THEN
+    PERFORM public.apply_interaction_delta(
+      NEW.tweet_id, NEW.comment_id,
+      NEW.is_liked::integer, NEW.is_saved::integer, NEW.is_restacked::integer);
+  END IF;
+  RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS on_interaction_changed ON public.user_tweet_interactions;
+CREATE TRIGGER on_interaction_changed
+AFTER INSERT OR UPDATE OR DELETE ON public.user_tweet_interactions
+FOR EACH ROW EXECUTE PROCEDURE public.sync_interaction_counters();
+
+-- tweets.comments counts every comment on a tweet and tweets.replies only
+-- the top-level ones; comments.replies counts a comment's direct replies.
+CREATE OR REPLACE FUNCTION public.sync_comment_counters()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  changed public.comments;
+  delta integer;
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    changed := NEW;
+    delta := 1;
+  ELSE
+    changed := OLD;
+    delta := -1;
+  END IF;
+  UPDATE public.tweets
+  SET comments = comments + delta,
+      replies = replies + CASE WHEN changed.parent_comment_id IS NULL THEN delta ELSE 0 END
+  WHERE id = changed.tweet_id;
+  IF changed.parent_comment_id IS NOT NULL THEN
+    UPDATE public.comments SET replies = replies + delta WHERE id = changed.parent_comment_id;
+  END IF;
+  RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS on_comment_changed ON public.comments;
+CREATE TRIGGER on_comment_changed
+AFTER INSERT OR DELETE ON public.comments
+FOR EACH ROW EXECUTE PROCEDURE public.sync_comment_counters();
+
+-- Recompute every counter from scratch. Returns the number of tweets and
+-- comments whose counters changed.
+CREATE OR REPLACE FUNCTION public.reconcile_counters()
+RETURNS integer
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  tweet_rows integer;
+  comment_rows integer;
+BEGIN
+  UPDATE public.tweets t
+  SET likes = n.likes,
+      saves = n.saves,
+      restacks = n.restacks,
+      comments = n.comments,
+      replies = n.replies
+  FROM (
+    SELECT t2.id,
+      (SELECT count(*) FROM public.user_tweet_interactions i
+        WHERE i.tweet_id = t2.id AND i.comment_id IS NULL AND i.is_liked)::integer AS likes,
+      (SELECT count(*) FROM public.user_tweet_interactions i
+        WHERE i.tweet_id = t2.id AND i.comment_id IS NULL AND i.is_saved)::integer AS saves,
+      (SELECT count(*) FROM public.user_tweet_interactions i
+        WHERE i.tweet_id = t2.id AND i.comment_id IS NULL AND i.is_restacked)::integer AS restacks,
+      (SELECT count(*) FROM public.comments c
+        WHERE c.tweet_id = t2.id)::integer AS comments,
+      (SELECT count(*) FROM public.comments c
+        WHERE c.tweet_id = t2.id AND c.parent_comment_id IS NULL)::integer AS replies
+    FROM public.tweets t2
+  ) n
+  WHERE n.id = t.id
+    AND (t.likes, t.saves, t.restacks, t.comments, t.replies)
+        IS DISTINCT FROM (n.likes, n.saves, n.restacks, n.comments, n.replies);
+  GET DIAGNOSTICS tweet_rows = ROW_COUNT;
+
+  UPDATE public.comments c
+  SET likes = n.likes,
+      replies = n.replies
+  FROM (
+    SELECT c2.id,
+      (SELECT count(*) FROM public.user_tweet_interactions i
+        WHERE i.comment_id = c2.id AND i.is_liked)::integer AS likes,
+      (SELECT count(*) FROM public.comments r
+        WHERE r.parent_comment_id = c2.id)::integer AS replies
+    FROM public.comments c2
+  ) n
+  WHERE n.id = c.id
+    AND (c.likes, c.replies) IS DISTINCT FROM (n.likes, n.replies);
+  GET DIAGNOSTICS comment_rows = ROW_COUNT;
+
+  RETURN tweet_rows + comment_rows;
+END;
+$$;
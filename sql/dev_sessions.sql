@@ -0,0 +1,26 @@
+-- Development identities for the in-memory store (STORE_BACKEND=memory).
+-- The session token dev-session-<n> authenticates as public user <n>.
+-- Not for real databases: next_auth.users rows are created by Auth.js.
+INSERT INTO user_auth_map (auth_user_id, user_id) VALUES
+('00000000-0000-0000-0000-000000000001', 1),
+('00000000-0000-0000-0000-000000000002', 2),
+('00000000-0000-0000-0000-000000000003', 3),
+('00000000-0000-0000-0000-000000000004', 4),
+('00000000-0000-0000-0000-000000000005', 5),
+('00000000-0000-0000-0000-000000000006', 6),
+('00000000-0000-0000-0000-000000000007', 7),
+('00000000-0000-0000-0000-000000000008', 8),
+('00000000-0000-0000-0000-000000000009', 9),
+('00000000-0000-0000-0000-000000000010', 10);
+
+INSERT INTO next_auth.sessions (expires, "sessionToken", "userId") VALUES
+('2099-01-01 00:00:00', 'dev-session-1', '00000000-0000-0000-0000-000000000001'),
+('2099-01-01 00:00:00', 'dev-session-2', '00000000-0000-0000-0000-000000000002'),
+('2099-01-01 00:00:00', 'dev-session-3', '00000000-0000-0000-0000-000000000003'),
+('2099-01-01 00:00:00', 'dev-session-4', '00000000-0000-0000-0000-000000000004'),
+('2099-01-01 00:00:00', 'dev-session-5', '00000000-0000-0000-0000-000000000005'),
+('2099-01-01 00:00:00', 'dev-session-6', '00000000-0000-0000-0000-000000000006'),
+('2099-01-01 00:00:00', 'dev-session-7', '00000000-0000-0000-0000-000000000007'),
+('2099-01-01 00:00:00', 'dev-session-8', '00000000-0000-0000-0000-000000000008'),
+('2099-01-01 00:00:00', 'dev-session-9', '00000000-0000-0000-0000-000000000009'),
+('2099-01-01 00:00:00', 'dev-session-10', '00000000-0000-0000-0000-000000000010');
@@ -0,0 +1,41 @@
+-- Edit tracking for tweets and comments
+-- Whenever a body changes, the prior version is kept in edit_history and
+-- is_edited/last_edited_at are set. Apply after schema.sql.
+
+CREATE OR REPLACE FUNCTION public.record_tweet_edit()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF NEW.body IS DISTINCT FROM OLD.body THEN
+    INSERT INTO public.edit_history (tweet_id, body) VALUES (OLD.id, OLD.body);
+    NEW.is_edited := TRUE;
+    NEW.last_edited_at := NOW();
+  END IF;
+  RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS on_tweet_edited ON public.tweets;
+CREATE TRIGGER on_tweet_edited
+BEFORE UPDATE OF body ON public.tweets
+FOR EACH ROW EXECUTE PROCEDURE public.record_tweet_edit();
+
+CREATE OR REPLACE FUNCTION public.record_comment_edit()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF NEW.body IS DISTINCT FROM OLD.body THEN
+    INSERT INTO public.edit_history (comment_id, body) VALUES (OLD.id, OLD.body);
+    NEW.is_edited := TRUE;
+    NEW.last_edited_at := NOW();
+  END IF;
+  RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS on_comment_edited ON public.comments;
+CREATE TRIGGER on_comment_edited
+BEFORE UPDATE OF body ON public.comments
+FOR EACH ROW EXECUTE PROCEDURE public.record_comment_edit();
@@ -0,0 +1,39 @@
+-- Hashtags
+-- Keeps tweet_hashtags in step with tweet bodies as tweets are written and
+-- edited. A hashtag is a "#" that does not follow a word character or another
+-- "#", then a run of letters, digits and underscores holding at least one
+-- letter; models.ExtractEntities applies the same rule. Apply after
+-- schema.sql.
+
+-- The lowercased hashtags in body.
+CREATE OR REPLACE FUNCTION public.extract_hashtags(body text)
+RETURNS SETOF text
+LANGUAGE sql
+IMMUTABLE
+AS $$
+  SELECT DISTINCT lower(m[2])
+  FROM regexp_matches(body, '(^|[^[:alnum:]_#])#([[:alnum:]_]+)', 'g') AS m
+  WHERE m[2] ~ '[[:alpha:]]';
+$$;
+
+CREATE OR REPLACE FUNCTION public.index_tweet_hashtags()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  DELETE FROM public.tweet_hashtags WHERE tweet_id = NEW.id;
+  INSERT INTO public.tweet_hashtags (tweet_id, tag)
+  SELECT NEW.id, tag FROM public.extract_hashtags(NEW.body) AS tag;
+  RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS on_tweet_body_changed ON public.tweets;
+CREATE TRIGGER on_tweet_body_changed
+AFTER INSERT OR UPDATE OF body ON public.tweets
+FOR EACH ROW EXECUTE PROCEDURE public.index_tweet_hashtags();
+
+-- Index tweets written before the trigger existed.
+INSERT INTO public.tweet_hashtags (tweet_id, tag)
+SELECT t.id, tag FROM public.tweets t, public.extract_hashtags(t.body) AS tag
+ON CONFLICT DO NOTHING;
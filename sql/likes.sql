@@ -0,0 +1,24 @@
+-- Likes
+-- Stamps likes with the time they happened so a user's likes list in the
+-- order they were made. Apply after schema.sql.
+
+-- Set liked_at whenever is_liked turns on, and clear it when the like is
+-- undone.
+CREATE OR REPLACE FUNCTION public.stamp_liked_at()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF NEW.is_liked AND (TG_OP = 'INSERT' OR NOT OLD.is_liked) THEN
+    NEW.liked_at := NOW();
+  ELSIF NOT NEW.is_liked THEN
+    NEW.liked_at := NULL;
+  END IF;
+  RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS on_like_changed ON public.user_tweet_interactions;
+CREATE TRIGGER on_like_changed
+BEFORE INSERT OR UPDATE OF is_liked ON public.user_tweet_interactions
+FOR EACH ROW EXECUTE PROCEDURE public.stamp_liked_at();
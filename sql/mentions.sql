@@ -0,0 +1,74 @@
+-- Mentions
+-- Keeps mentions in step with tweet and comment bodies as they are written and
+-- edited. A mention is an "@" that does not follow a word character or another
+-- "@", then a run of letters, digits and underscores naming a user, compared
+-- case-insensitively; models.ExtractEntities applies the same rule. Mentions
+-- an edit keeps retain their created_at. Apply after schema.sql.
+
+-- The ids of the users mentioned in body.
+CREATE OR REPLACE FUNCTION public.extract_mentions(body text)
+RETURNS SETOF integer
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT u.id FROM public.users u
+  WHERE lower(u.username) IN (
+    SELECT lower(m[2])
+    FROM regexp_matches(body, '(^|[^[:alnum:]_@])@([[:alnum:]_]+)', 'g') AS m);
+$$;
+
+-- The users with the given lowercased usernames.
+CREATE OR REPLACE FUNCTION public.users_by_username(usernames text[])
+RETURNS SETOF public.users
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT * FROM public.users WHERE lower(username) = ANY(usernames);
+$$;
+
+CREATE OR REPLACE FUNCTION public.index_tweet_mentions()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  DELETE FROM public.mentions
+  WHERE tweet_id = NEW.id AND user_id NOT IN (SELECT public.extract_mentions(NEW.body));
+  INSERT INTO public.mentions (user_id, tweet_id)
+  SELECT id, NEW.id FROM public.extract_mentions(NEW.body) AS id
+  ON CONFLICT DO NOTHING;
+  RETURN NULL;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.index_comment_mentions()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  DELETE FROM public.mentions
+  WHERE comment_id = NEW.id AND user_id NOT IN (SELECT public.extract_mentions(NEW.body));
+  INSERT INTO public.mentions (user_id, comment_id)
+  SELECT id, NEW.id FROM public.extract_mentions(NEW.body) AS id
+  ON CONFLICT DO NOTHING;
+  RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS on_tweet_mentions_changed ON public.tweets;
+CREATE TRIGGER on_tweet_mentions_changed
+AFTER INSERT OR UPDATE OF body ON public.tweets
+FOR EACH ROW EXECUTE PROCEDURE public.index_tweet_mentions();
+
+DROP TRIGGER IF EXISTS on_comment_mentions_changed ON public.comments;
+CREATE TRIGGER on_comment_mentions_changed
+AFTER INSERT OR UPDATE OF body ON public.comments
+FOR EACH ROW EXECUTE PROCEDURE public.index_comment_mentions();
+
+-- Index tweets and comments written before the triggers existed.
+INSERT INTO public.mentions (user_id, tweet_id, created_at)
+SELECT id, t.id, t.created_at FROM public.tweets t, public.extract_mentions(t.body) AS id
+ON CONFLICT DO NOTHING;
+
+INSERT INTO public.mentions (user_id, comment_id, created_at)
+SELECT id, c.id, c.created_at FROM public.comments c, public.extract_mentions(c.body) AS id
+ON CONFLICT DO NOTHING;
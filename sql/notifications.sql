@@ -0,0 +1,206 @@
+-- Notifications
+-- Records likes, restacks, replies, follows and mentions as notifications for
+-- the user they concern. Events of one kind on one target join the unread
+-- notification for it, if any, and undoing a like, restack, follow or mention
+-- takes its actor back out. Nobody is notified of their own actions. Apply
+-- after schema.sql and mentions.sql.
+
+-- Add actor to recipient's unread notification of kind on the target,
+-- starting one when there is none.
+CREATE OR REPLACE FUNCTION public.notify(
+  recipient integer,
+  actor integer,
+  notification_kind text,
+  target_tweet_id integer,
+  target_comment_id integer
+) RETURNS void
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  nid integer;
+BEGIN
+  IF recipient IS NULL OR actor IS NULL OR recipient = actor THEN
+    RETURN;
+  END IF;
+  INSERT INTO public.notifications (user_id, kind, tweet_id, comment_id)
+  VALUES (recipient, notification_kind, target_tweet_id, target_comment_id)
+  ON CONFLICT (user_id, kind, tweet_id, comment_id) WHERE read_at IS NULL
+  DO UPDATE SET updated_at = NOW()
+  RETURNING id INTO nid;
+  INSERT INTO public.notification_actors (notification_id, actor_id)
+  VALUES (nid, actor)
+  ON CONFLICT ON CONSTRAINT notification_actors_pkey DO UPDATE SET created_at = NOW();
+END;
+$$;
+
+-- Take actor out of recipient's notifications of kind on the target,
+-- dropping those left without actors.
+CREATE OR REPLACE FUNCTION public.unnotify(
+  recipient integer,
+  actor integer,
+  notification_kind text,
+  target_tweet_id integer,
+  target_comment_id integer
+) RETURNS void
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  DELETE FROM public.notification_actors a
+  USING public.notifications n
+  WHERE a.notification_id = n.id
+    AND a.actor_id = actor
+    AND n.user_id = recipient
+    AND n.kind = notification_kind
+    AND n.tweet_id IS NOT DISTINCT FROM target_tweet_id
+    AND n.comment_id IS NOT DISTINCT FROM target_comment_id;
+  DELETE FROM public.notifications n
+  WHERE n.user_id = recipient
+    AND n.kind = notification_kind
+    AND n.tweet_id IS NOT DISTINCT FROM target_tweet_id
+    AND n.comment_id IS NOT DISTINCT FROM target_comment_id
+    AND NOT EXISTS (SELECT 1 FROM public.notification_actors a WHERE a.notification_id = n.id);
+END;
+$$;
+
+-- The author of a tweet, or of a comment when comment_id is set.
+CREATE OR REPLACE FUNCTION public.target_author(target_tweet_id integer, target_comment_id integer)
+RETURNS integer
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT CASE
+    WHEN target_comment_id IS NOT NULL THEN (SELECT c.user_id FROM public.comments c WHERE c.id = target_comment_id)
+    ELSE (SELECT t.user_id FROM public.tweets t WHERE t.id = target_tweet_id)
+  END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.notify_interaction()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  recipient integer := public.target_author(NEW.tweet_id, NEW.comment_id);
+  target_tweet_id integer := CASE WHEN NEW.comment_id IS NULL THEN NEW.tweet_id END;
+  was_liked boolean := TG_OP = 'UPDATE' AND OLD.is_liked;
+  was_restacked boolean := TG_OP = 'UPDATE' AND OLD.is_restacked;
+BEGIN
+  IF NEW.is_liked AND NOT was_liked THEN
+    PERFORM public.notify(recipient, NEW.user_id, 'like', target_tweet_id, NEW.comment_id);
+  ELSIF was_liked AND NOT NEW.is_liked THEN
+    PERFORM public.unnotify(recipient, NEW.user_id, 'like', target_tweet_id, NEW.comment_id);
+  END IF;
+  IF NEW.is_restacked AND NOT was_restacked THEN
+    PERFORM public.notify(recipient, NEW.user_id, 'restack', target_tweet_id, NEW.comment_id);
+  ELSIF was_restacked AND NOT NEW.is_restacked THEN
+    PERFORM public.unnotify(recipient, NEW.user_id, 'restack', target_tweet_id, NEW.comment_id);
+  END IF;
+  RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS on_interaction_notify ON public.user_tweet_interactions;
+CREATE TRIGGER on_interaction_notify
+AFTER INSERT OR UPDATE OF is_liked, is_restacked ON public.user_tweet_interactions
+FOR EACH ROW EXECUTE PROCEDURE public.notify_interaction();
+
+-- A comment notifies the author of the comment it replies to, or of the
+-- tweet for a top-level comment.
+CREATE OR REPLACE FUNCTION public.notify_reply()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF NEW.parent_comment_id IS NOT NULL THEN
+    PERFORM public.notify(public.target_author(NULL, NEW.parent_comment_id),
+      NEW.user_id, 'reply', NULL, NEW.parent_comment_id);
+  ELSE
+    PERFORM public.notify(public.target_author(NEW.tweet_id, NULL),
+      NEW.user_id, 'reply', NEW.tweet_id, NULL);
+  END IF;
+  RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS on_comment_notify ON public.comments;
+CREATE TRIGGER on_comment_notify
+AFTER INSERT ON public.comments
+FOR EACH ROW EXECUTE PROCEDURE public.notify_reply();
+
+CREATE OR REPLACE FUNCTION public.notify_follow()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    PERFORM public.notify(NEW.following_user_id, NEW.user_id, 'follow', NULL, NULL);
+  ELSE
+    PERFORM public.unnotify(OLD.following_user_id, OLD.user_id, 'follow', NULL, NULL);
+  END IF;
+  RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS on_follow_notify ON public.user_following;
+CREATE TRIGGER on_follow_notify
+AFTER INSERT OR DELETE ON public.user_following
+FOR EACH ROW EXECUTE PROCEDURE public.notify_follow();
+
+-- A mention notifies the mentioned user, with the mentioning tweet or comment
+-- as its target.
+CREATE OR REPLACE FUNCTION public.notify_mention()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    PERFORM public.notify(NEW.user_id, public.target_author(NEW.tweet_id, NEW.comment_id),
+      'mention', NEW.tweet_id, NEW.comment_id);
+  ELSE
+    PERFORM public.unnotify(OLD.user_id, public.target_author(OLD.tweet_id, OLD.comment_id),
+      'mention', OLD.tweet_id, OLD.comment_id);
+  END IF;
+  RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS on_mention_notify ON public.mentions;
+CREATE TRIGGER on_mention_notify
+AFTER INSERT OR DELETE ON public.mentions
+FOR EACH ROW EXECUTE PROCEDURE public.notify_mention();
+
+-- One page of a user's notifications, most recently updated first, with the
+-- number of actors and the ids of the latest actor_limit of them.
+CREATE OR REPLACE FUNCTION public.notifications_page(
+  viewer integer,
+  before_at timestamptz,
+  before_id integer,
+  page_size integer,
+  actor_limit integer
+) RETURNS TABLE (
+  id integer,
+  user_id integer,
+  kind text,
+  tweet_id integer,
+  comment_id integer,
+  created_at timestamptz,
+  updated_at timestamptz,
+  read_at timestamptz,
+  actor_count integer,
+  actor_ids integer[]
+)
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT n.id, n.user_id, n.kind, n.tweet_id, n.comment_id, n.created_at, n.updated_at, n.read_at,
+    (SELECT count(*)::integer FROM public.notification_actors a WHERE a.notification_id = n.id),
+    ARRAY(
+      SELECT a.actor_id FROM public.notification_actors a
+      WHERE a.notification_id = n.id
+      ORDER BY a.created_at DESC, a.actor_id DESC
+      LIMIT actor_limit)
+  FROM public.notifications n
+  WHERE n.user_id = viewer
+    AND (before_at IS NULL OR (n.updated_at, n.id) < (before_at, before_id))
+  ORDER BY n.updated_at DESC, n.id DESC
+  LIMIT page_size;
+$$;
@@ -15,6 +15,7 @@ CREATE TABLE IF NOT EXISTS tweets (
     saves INTEGER NOT NULL DEFAULT 0,
     restacks INTEGER NOT NULL DEFAULT 0,
     replies INTEGER NOT NULL DEFAULT 0,
+    comments INTEGER NOT NULL DEFAULT 0,
     is_edited BOOLEAN NOT NULL DEFAULT FALSE,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     last_edited_at TIMESTAMPTZ
@@ -23,7 +24,8 @@ CREATE TABLE IF NOT EXISTS tweets (
 CREATE TABLE IF NOT EXISTS comments (
     id SERIAL PRIMARY KEY,
     user_id INTEGER NOT NULL REFERENCES users(id),
-    tweet_id INTEGER NOT NULL REFERENCES tweets(id),
+    tweet_id INTEGER NOT NULL REFERENCES tweets(id) ON DELETE CASCADE,
+    parent_comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
     body TEXT NOT NULL,
     likes INTEGER NOT NULL DEFAULT 0,
     replies INTEGER NOT NULL DEFAULT 0,
@@ -34,6 +36,13 @@ CREATE TABLE IF NOT EXISTS comments (
 
 
 
+-- Ensure comments can reply to other comments. A reply belongs to the same
+-- tweet as its parent.
+ALTER TABLE IF EXISTS comments
+ADD COLUMN IF NOT EXISTS parent_comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS comments_parent ON comments (parent_comment_id, created_at, id);
+
 -- Ensure tweets has a comments column
 ALTER TABLE IF EXISTS tweets
 ADD COLUMN IF NOT EXISTS comments INTEGER NOT NULL DEFAULT 0;
@@ -42,14 +51,33 @@ ADD COLUMN IF NOT EXISTS comments INTEGER NOT NULL DEFAULT 0;
 CREATE TABLE IF NOT EXISTS user_tweet_interactions (
     id SERIAL PRIMARY KEY,
     user_id INTEGER NOT NULL REFERENCES users(id),
-    tweet_id INTEGER REFERENCES tweets(id),
-    comment_id INTEGER REFERENCES comments(id),
+    tweet_id INTEGER REFERENCES tweets(id) ON DELETE CASCADE,
+    comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
     is_saved BOOLEAN NOT NULL DEFAULT FALSE,
     is_liked BOOLEAN NOT NULL DEFAULT FALSE,
     is_restacked BOOLEAN NOT NULL DEFAULT FALSE,
+    liked_at TIMESTAMPTZ,
+    restacked_at TIMESTAMPTZ,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+-- Ensure user_tweet_interactions records when a restack happened
+ALTER TABLE IF EXISTS public.user_tweet_interactions
+ADD COLUMN IF NOT EXISTS restacked_at TIMESTAMPTZ;
+
+UPDATE public.user_tweet_interactions SET restacked_at = created_at
+WHERE is_restacked AND restacked_at IS NULL;
+
+-- Ensure user_tweet_interactions records when a like happened
+ALTER TABLE IF EXISTS public.user_tweet_interactions
+ADD COLUMN IF NOT EXISTS liked_at TIMESTAMPTZ;
+
+UPDATE public.user_tweet_interactions SET liked_at = created_at
+WHERE is_liked AND liked_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS user_tweet_interactions_liked
+  ON public.user_tweet_interactions (user_id, liked_at DESC, id DESC) WHERE is_liked;
+
 -- Ensure constraint: at least one of tweet_id or comment_id is non-null
 DO $$
 BEGIN
@@ -68,3 +96,133 @@ END$$;
 -- If table existed previously with NOT NULL on tweet_id, relax it
 ALTER TABLE IF EXISTS public.user_tweet_interactions
   ALTER COLUMN tweet_id DROP NOT NULL;
+
+-- One interaction row per user and target; NULLS NOT DISTINCT lets
+-- ON CONFLICT (user_id, tweet_id, comment_id) match rows with a NULL target.
+CREATE UNIQUE INDEX IF NOT EXISTS user_tweet_interactions_user_target
+  ON public.user_tweet_interactions (user_id, tweet_id, comment_id) NULLS NOT DISTINCT;
+
+-- Tweet hashtags: the lowercased tags in each tweet body, kept current by the
+-- triggers in sql/hashtags.sql
+CREATE TABLE IF NOT EXISTS tweet_hashtags (
+    tweet_id INTEGER NOT NULL REFERENCES tweets(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (tweet_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS tweet_hashtags_tag ON tweet_hashtags (tag, tweet_id);
+
+-- Bookmark folders: named folders a user files their saved tweets into
+CREATE TABLE IF NOT EXISTS bookmark_folders (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+-- Ensure user_tweet_interactions records when a tweet was saved and the
+-- folder it is filed in. Deleting a folder leaves its tweets saved, unfiled.
+ALTER TABLE IF EXISTS public.user_tweet_interactions
+ADD COLUMN IF NOT EXISTS saved_at TIMESTAMPTZ;
+
+ALTER TABLE IF EXISTS public.user_tweet_interactions
+ADD COLUMN IF NOT EXISTS folder_id INTEGER REFERENCES bookmark_folders(id) ON DELETE SET NULL;
+
+UPDATE public.user_tweet_interactions SET saved_at = created_at
+WHERE is_saved AND saved_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS user_tweet_interactions_saved
+  ON public.user_tweet_interactions (user_id, saved_at DESC, tweet_id DESC) WHERE is_saved;
+
+-- User Following: directed follow graph, user_id follows following_user_id
+CREATE TABLE IF NOT EXISTS user_following (
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    following_user_id INTEGER NOT NULL REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, following_user_id)
+);
+
+-- Edit history: the prior versions of edited tweets and comments. created_at
+-- is when the version was replaced.
+CREATE TABLE IF NOT EXISTS edit_history (
+    id SERIAL PRIMARY KEY,
+    tweet_id INTEGER REFERENCES tweets(id) ON DELETE CASCADE,
+    comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT edit_history_has_target CHECK ((tweet_id IS NULL) <> (comment_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS edit_history_tweet ON edit_history (tweet_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS edit_history_comment ON edit_history (comment_id, created_at DESC, id DESC);
+
+-- Deleting a tweet or comment removes its comments, interactions and edit
+-- history. Recreate foreign keys made before they cascaded.
+DO $$
+DECLARE
+  fk record;
+BEGIN
+  FOR fk IN
+    SELECT * FROM (VALUES
+      ('comments', 'comments_tweet_id_fkey', 'tweet_id', 'tweets'),
+      ('user_tweet_interactions', 'user_tweet_interactions_tweet_id_fkey', 'tweet_id', 'tweets'),
+      ('user_tweet_interactions', 'user_tweet_interactions_comment_id_fkey', 'comment_id', 'comments'),
+      ('edit_history', 'edit_history_tweet_id_fkey', 'tweet_id', 'tweets'),
+      ('edit_history', 'edit_history_comment_id_fkey', 'comment_id', 'comments')
+    ) AS v(tbl, name, col, ref)
+  LOOP
+    IF EXISTS (
+      SELECT 1 FROM information_schema.referential_constraints
+      WHERE constraint_schema = 'public'
+        AND constraint_name = fk.name
+        AND delete_rule <> 'CASCADE'
+    ) THEN
+      EXECUTE format('ALTER TABLE public.%I DROP CONSTRAINT %I', fk.tbl, fk.name);
+      EXECUTE format('ALTER TABLE public.%I ADD CONSTRAINT %I FOREIGN KEY (%I) REFERENCES public.%I(id) ON DELETE CASCADE',
+        fk.tbl, fk.name, fk.col, fk.ref);
+    END IF;
+  END LOOP;
+END$$;
+
+-- Mentions: the users each tweet or comment mentions by @username, kept in
+-- step with bodies by sql/mentions.sql. created_at is when the mention was
+-- first written.
+CREATE TABLE IF NOT EXISTS mentions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tweet_id INTEGER REFERENCES tweets(id) ON DELETE CASCADE,
+    comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT mentions_has_target CHECK ((tweet_id IS NULL) <> (comment_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS mentions_tweet ON mentions (tweet_id, user_id) WHERE tweet_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS mentions_comment ON mentions (comment_id, user_id) WHERE comment_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS mentions_user ON mentions (user_id, created_at DESC, id DESC);
+
+-- Notifications: what happened to a user's tweets, comments and profile.
+-- Events of one kind on one target gather into a single unread notification
+-- whose actors are kept in notification_actors, so that "Ana and 4 others
+-- liked your tweet" is one row. Kept current by sql/notifications.sql.
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    tweet_id INTEGER REFERENCES tweets(id) ON DELETE CASCADE,
+    comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    read_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS notifications_unread_target
+  ON notifications (user_id, kind, tweet_id, comment_id) NULLS NOT DISTINCT WHERE read_at IS NULL;
+CREATE INDEX IF NOT EXISTS notifications_user ON notifications (user_id, updated_at DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS notification_actors (
+    notification_id INTEGER NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    actor_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (notification_id, actor_id)
+);
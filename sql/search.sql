@@ -0,0 +1,92 @@
+-- Search
+-- Full-text search over tweets, comments and users, ranked best match first
+-- and then newest first. search_text is websearch_to_tsquery syntax; an
+-- empty search_text matches every row and leaves the operators to filter.
+-- Apply after schema.sql.
+
+CREATE INDEX IF NOT EXISTS tweets_body_search
+  ON public.tweets USING gin (to_tsvector('english', body));
+
+CREATE INDEX IF NOT EXISTS comments_body_search
+  ON public.comments USING gin (to_tsvector('english', body));
+
+CREATE INDEX IF NOT EXISTS users_search
+  ON public.users USING gin (to_tsvector('simple',
+    username || ' ' || COALESCE(profile_name, '') || ' ' || COALESCE(bio, '')));
+
+-- The ids of one page of the tweets matching a search, with their ranks.
+CREATE OR REPLACE FUNCTION public.search_tweets(
+  search_text text,
+  from_username text,
+  before_at timestamptz,
+  after_at timestamptz,
+  has_replies boolean,
+  page_size integer,
+  page_offset integer
+) RETURNS TABLE (tweet_id integer, rank real)
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT t.id,
+    CASE WHEN search_text = '' THEN 0
+      ELSE ts_rank_cd(to_tsvector('english', t.body), websearch_to_tsquery('english', search_text))
+    END AS rank
+  FROM public.tweets t
+  WHERE (search_text = '' OR to_tsvector('english', t.body) @@ websearch_to_tsquery('english', search_text))
+    AND (from_username IS NULL OR t.user_id IN (
+      SELECT u.id FROM public.users u WHERE lower(u.username) = lower(from_username)))
+    AND (before_at IS NULL OR t.created_at < before_at)
+    AND (after_at IS NULL OR t.created_at >= after_at)
+    AND (NOT has_replies OR t.comments > 0)
+  ORDER BY rank DESC, t.created_at DESC, t.id DESC
+  LIMIT page_size OFFSET page_offset;
+$$;
+
+-- search_tweets for comments.
+CREATE OR REPLACE FUNCTION public.search_comments(
+  search_text text,
+  from_username text,
+  before_at timestamptz,
+  after_at timestamptz,
+  has_replies boolean,
+  page_size integer,
+  page_offset integer
+) RETURNS TABLE (comment_id integer, rank real)
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT c.id,
+    CASE WHEN search_text = '' THEN 0
+      ELSE ts_rank_cd(to_tsvector('english', c.body), websearch_to_tsquery('english', search_text))
+    END AS rank
+  FROM public.comments c
+  WHERE (search_text = '' OR to_tsvector('english', c.body) @@ websearch_to_tsquery('english', search_text))
+    AND (from_username IS NULL OR c.user_id IN (
+      SELECT u.id FROM public.users u WHERE lower(u.username) = lower(from_username)))
+    AND (before_at IS NULL OR c.created_at < before_at)
+    AND (after_at IS NULL OR c.created_at >= after_at)
+    AND (NOT has_replies OR c.replies > 0)
+  ORDER BY rank DESC, c.created_at DESC, c.id DESC
+  LIMIT page_size OFFSET page_offset;
+$$;
+
+-- The ids of one page of the users whose username, profile name or bio
+-- match search_text, with their ranks.
+CREATE OR REPLACE FUNCTION public.search_users(
+  search_text text,
+  page_size integer,
+  page_offset integer
+) RETURNS TABLE (user_id integer, rank real)
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT u.id,
+    ts_rank_cd(
+      to_tsvector('simple', u.username || ' ' || COALESCE(u.profile_name, '') || ' ' || COALESCE(u.bio, '')),
+      websearch_to_tsquery('simple', search_text)) AS rank
+  FROM public.users u
+  WHERE to_tsvector('simple', u.username || ' ' || COALESCE(u.profile_name, '') || ' ' || COALESCE(u.bio, ''))
+    @@ websearch_to_tsquery('simple', search_text)
+  ORDER BY rank DESC, u.created_at DESC, u.id DESC
+  LIMIT page_size OFFSET page_offset;
+$$;
@@ -0,0 +1,100 @@
+-- Timelines
+-- Stamps restacks with the time they happened and builds the feeds that mix
+-- tweets with restacks: the "following" home timeline and user profile feeds.
+-- Apply after schema.sql.
+
+-- Set restacked_at whenever is_restacked turns on, and clear it when the
+-- restack is undone.
+CREATE OR REPLACE FUNCTION public.stamp_restacked_at()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF NEW.is_restacked AND (TG_OP = 'INSERT' OR NOT OLD.is_restacked) THEN
+    NEW.restacked_at := NOW();
+  ELSIF NOT NEW.is_restacked THEN
+    NEW.restacked_at := NULL;
+  END IF;
+  RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS on_restack_changed ON public.user_tweet_interactions;
+CREATE TRIGGER on_restack_changed
+BEFORE INSERT OR UPDATE OF is_restacked ON public.user_tweet_interactions
+FOR EACH ROW EXECUTE PROCEDURE public.stamp_restacked_at();
+
+-- The feed functions gained before_by; drop the versions without it.
+DROP FUNCTION IF EXISTS public.following_timeline(integer, timestamptz, integer, integer);
+DROP FUNCTION IF EXISTS public.user_feed(integer, timestamptz, integer, integer);
+DROP FUNCTION IF EXISTS public.feed_page(integer[], timestamptz, integer, integer);
+
+-- One page of the tweets written or restacked by any of sources, with one
+-- entry for each post and each restack. restacked_by names who restacked
+-- the tweet and is NULL for the post. Entries are keyed by (feed_at,
+-- tweet_id, restacked_by), a NULL restacked_by sorting below every user id.
+-- Pass NULL before_at for the first page and NULL before_by after a post.
+CREATE OR REPLACE FUNCTION public.feed_page(
+  sources integer[],
+  before_at timestamptz,
+  before_id integer,
+  before_by integer,
+  page_size integer
+) RETURNS TABLE (tweet_id integer, feed_at timestamptz, restacked_by integer)
+LANGUAGE sql
+STABLE
+AS $$
+  WITH events AS (
+    SELECT t.id AS tweet_id, t.created_at AS feed_at, NULL::integer AS restacked_by
+    FROM public.tweets t
+    WHERE t.user_id = ANY (sources)
+    UNION ALL
+    SELECT i.tweet_id, COALESCE(i.restacked_at, i.created_at), i.user_id
+    FROM public.user_tweet_interactions i
+    WHERE i.is_restacked
+      AND i.comment_id IS NULL
+      AND i.tweet_id IS NOT NULL
+      AND i.user_id = ANY (sources)
+  )
+  SELECT e.tweet_id, e.feed_at, e.restacked_by
+  FROM events e
+  WHERE before_at IS NULL
+     OR (e.feed_at, e.tweet_id, COALESCE(e.restacked_by, 0))
+        < (before_at, before_id, COALESCE(before_by, 0))
+  ORDER BY e.feed_at DESC, e.tweet_id DESC, e.restacked_by DESC NULLS LAST
+  LIMIT page_size;
+$$;
+
+-- The "following" home timeline: feed_page over viewer and the accounts
+-- viewer follows.
+CREATE OR REPLACE FUNCTION public.following_timeline(
+  viewer integer,
+  before_at timestamptz,
+  before_id integer,
+  before_by integer,
+  page_size integer
+) RETURNS TABLE (tweet_id integer, feed_at timestamptz, restacked_by integer)
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT * FROM public.feed_page(
+    ARRAY(
+      SELECT f.following_user_id FROM public.user_following f WHERE f.user_id = viewer
+    ) || viewer,
+    before_at, before_id, before_by, page_size);
+$$;
+
+-- A user's profile feed: feed_page over the user alone, so it holds their
+-- tweets and their restacks.
+CREATE OR REPLACE FUNCTION public.user_feed(
+  author integer,
+  before_at timestamptz,
+  before_id integer,
+  before_by integer,
+  page_size integer
+) RETURNS TABLE (tweet_id integer, feed_at timestamptz, restacked_by integer)
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT * FROM public.feed_page(ARRAY[author], before_at, before_id, before_by, page_size);
+$$;
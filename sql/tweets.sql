@@ -1,4 +1,4 @@
-INSERT INTO tweets (id, user_id, body, created_at, likes, comments, retweets, saves) VALUES
+INSERT INTO tweets (id, user_id, body, created_at, likes, comments, restacks, saves) VALUES
 (1, 1, 'Tech company unveils new AI chip to speed up machine learning.', '2023-01-15 10:00:00', 210, 3, 45, 12),
 (2, 1, 'New study shows climate change is accelerating polar ice melt.', '2023-02-08 09:30:00', 175, 2, 30, 20),
 (3, 1, 'City passes law to expand affordable housing units.', '2023-03-10 14:20:00', 90, 1, 10, 5),
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/et-hicks/imitation-backend/store"
+)
+
+type authContextKey struct{}
+
+var (
+	errInvalidToken = errors.New("invalid token")
+	errExpiredToken = errors.New("expired token")
+	errUnmappedUser = errors.New("auth user has no public user")
+)
+
+// Authenticate resolves the bearer credential on a request to a public.users id
+// and stores it on the request context. A credential is either a JWT signed with
+// SUPABASE_JWT_SECRET whose sub is a next_auth.users id, or a
+// next_auth.sessions sessionToken. Requests without an Authorization header
+// pass through anonymously; requests with an invalid one are rejected.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || strings.TrimSpace(token) == "" {
+			writeError(w, unauthorized("invalid authorization"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, err := resolveToken(ctx, strings.TrimSpace(token))
+		if err != nil {
+			log.Println("authentication failed:", err)
+			writeError(w, unauthorized("invalid authorization"))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authContextKey{}, userID)))
+	})
+}
+
+// UserIDFromContext returns the public.users id stored by Authenticate.
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(authContextKey{}).(int)
+	return id, ok
+}
+
+// requireUser returns the authenticated user id or writes a 401.
+func requireUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, ok := UserIDFromContext(r.Context())
+	if !ok {
+		writeError(w, unauthorized("missing authorization"))
+		return 0, false
+	}
+	return id, true
+}
+
+// requireSelf returns the authenticated user id, writing a 401 for anonymous
+// requests and a 403 when it does not match the user id in the path.
+func requireSelf(w http.ResponseWriter, r *http.Request, pathUserID int) (int, bool) {
+	id, ok := requireUser(w, r)
+	if !ok {
+		return 0, false
+	}
+	if id != pathUserID {
+		writeError(w, forbidden("the path names another user"))
+		return 0, false
+	}
+	return id, true
+}
+
+// resolveToken maps a JWT or session token to a public.users id.
+func resolveToken(ctx context.Context, token string) (int, error) {
+	st, err := GetStore(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var authUserID string
+	if strings.Count(token, ".") == 2 {
+		secret := os.Getenv("SUPABASE_JWT_SECRET")
+		if secret == "" {
+			return 0, fmt.Errorf("SUPABASE_JWT_SECRET not set")
+		}
+		claims, err := verifyJWT(token, []byte(secret), time.Now())
+		if err != nil {
+			return 0, err
+		}
+		authUserID = claims.Subject
+	} else {
+		id, expires, err := st.SessionUser(ctx, token)
+		if errors.Is(err, store.ErrNotFound) {
+			return 0, errInvalidToken
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !time.Now().Before(expires) {
+			return 0, errExpiredToken
+		}
+		authUserID = id
+	}
+
+	userID, err := st.UserIDForAuthUser(ctx, authUserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return 0, errUnmappedUser
+	}
+	return userID, err
+}
+
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+// verifyJWT checks an HS256 signature and the time-based claims of a token.
+func verifyJWT(token string, secret []byte, now time.Time) (jwtClaims, error) {
+	var claims jwtClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return claims, errInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, errInvalidToken
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return claims, errInvalidToken
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil || claims.Subject == "" || claims.ExpiresAt == 0 {
+		return claims, errInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, errExpiredToken
+	}
+	if claims.NotBefore != 0 && now.Unix() < claims.NotBefore {
+		return claims, errInvalidToken
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
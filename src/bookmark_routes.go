@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/et-hicks/imitation-backend/store"
+)
+
+const maxFolderNameLength = 64
+
+// savedTweets returns a page of the tweets the caller saved, most recently
+// saved first. The folder query parameter limits it to one of their folders.
+func savedTweets(w http.ResponseWriter, r *http.Request, pathUserID int) {
+	log.Println("inilizied request")
+	userID, ok := requireSelf(w, r, pathUserID)
+	if !ok {
+		return
+	}
+	var folderID *int
+	if s := r.URL.Query().Get("folder"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			writeError(w, validationFailed("invalid folder id"))
+			return
+		}
+		folderID = &id
+	}
+	page, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	saved, err := st.SavedTweets(ctx, userID, folderID, page)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, notFound("folder not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var deco decorator
+	deco.addSaved(saved)
+	if err := deco.fill(ctx, st); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, page, saved, savedCursor)
+	log.Println("sent successfully")
+}
+
+// listFolders returns the caller's bookmark folders ordered by name.
+func listFolders(w http.ResponseWriter, r *http.Request, pathUserID int) {
+	log.Println("inilizied request")
+	userID, ok := requireSelf(w, r, pathUserID)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	folders, err := st.BookmarkFolders(ctx, userID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(folders)
+	log.Println("sent successfully")
+}
+
+// createFolder adds a bookmark folder for the caller. Folder names are unique
+// per user.
+func createFolder(w http.ResponseWriter, r *http.Request, pathUserID int) {
+	log.Println("inilizied request")
+	userID, ok := requireSelf(w, r, pathUserID)
+	if !ok {
+		return
+	}
+
+	var payload struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, validationFailed("invalid JSON body"))
+		return
+	}
+	name := strings.TrimSpace(payload.Name)
+	var v validator
+	v.text("name", &name, true, maxFolderNameLength)
+	if err := v.err(); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	folder, err := st.CreateBookmarkFolder(ctx, userID, name)
+	if errors.Is(err, store.ErrConflict) {
+		writeError(w, conflict("a folder with that name already exists"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(folder)
+	log.Println("sent successfully")
+}
+
+// deleteFolder deletes one of the caller's bookmark folders. The tweets filed
+// in it stay saved.
+func deleteFolder(w http.ResponseWriter, r *http.Request, pathUserID, folderID int) {
+	log.Println("inilizied request")
+	userID, ok := requireSelf(w, r, pathUserID)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = st.DeleteBookmarkFolder(ctx, userID, folderID)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, notFound("folder not found"))
+		return
+	case errors.Is(err, store.ErrForbidden):
+		writeError(w, forbidden("the folder belongs to another user"))
+		return
+	case err != nil:
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Println("sent successfully")
+}
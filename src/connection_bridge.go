@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 
+	"github.com/et-hicks/imitation-backend/store"
 	supabase "github.com/supabase-community/supabase-go"
 )
 
@@ -13,8 +15,67 @@ var (
 	sbClientSrc *supabase.Client
 	sbOnceSrc   sync.Once
 	sbErrSrc    error
+
+	sbAuthClientSrc *supabase.Client
+	sbAuthOnceSrc   sync.Once
+	sbAuthErrSrc    error
+
+	storeSrc  store.Store
+	storeOnce sync.Once
+	storeErr  error
 )
 
+// GetStore provides the data store used by handlers under src/. The backend
+// is chosen by STORE_BACKEND: "postgrest" (the default) uses Supabase,
+// "postgres" connects directly to DATABASE_URL, and "memory" keeps everything
+// in process, seeded from the comma separated SQL fixture files in
+// MEMORY_SEED. The backend is opened once and shared by every request, so
+// it is opened without ctx, which only lasts as long as the caller's request.
+func GetStore(ctx context.Context) (store.Store, error) {
+	storeOnce.Do(func() {
+		storeSrc, storeErr = newStore(context.Background(), os.Getenv("STORE_BACKEND"))
+	})
+	if storeErr != nil {
+		return nil, storeErr
+	}
+	return storeSrc, nil
+}
+
+func newStore(ctx context.Context, backend string) (store.Store, error) {
+	switch backend {
+	case "", "postgrest":
+		client, err := GetSupabase(ctx)
+		if err != nil {
+			return nil, err
+		}
+		nextAuth, err := GetNextAuthSupabase(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return store.NewPostgREST(client, nextAuth), nil
+	case "postgres":
+		url := os.Getenv("DATABASE_URL")
+		if url == "" {
+			return nil, fmt.Errorf("DATABASE_URL not set")
+		}
+		return store.OpenPostgres(ctx, url)
+	case "memory":
+		mem := store.NewMemory()
+		var seeds []string
+		for _, path := range strings.Split(os.Getenv("MEMORY_SEED"), ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				seeds = append(seeds, path)
+			}
+		}
+		if err := mem.SeedFiles(seeds...); err != nil {
+			return nil, err
+		}
+		return mem, nil
+	default:
+		return nil, fmt.Errorf("unknown STORE_BACKEND %q", backend)
+	}
+}
+
 // GetSupabase provides a Supabase client for files under src/.
 func GetSupabase(ctx context.Context) (*supabase.Client, error) {
 	sbOnceSrc.Do(func() {
@@ -32,9 +93,40 @@ func GetSupabase(ctx context.Context) (*supabase.Client, error) {
 	return sbClientSrc, nil
 }
 
-// ResetSupabaseForTests clears the cached client for tests.
+// GetNextAuthSupabase provides a Supabase client bound to the next_auth schema.
+func GetNextAuthSupabase(ctx context.Context) (*supabase.Client, error) {
+	sbAuthOnceSrc.Do(func() {
+		url := os.Getenv("SUPABASE_URL")
+		key := os.Getenv("SUPABASE_KEY")
+		if url == "" || key == "" {
+			sbAuthErrSrc = fmt.Errorf("SUPABASE_URL or SUPABASE_KEY not set")
+			return
+		}
+		sbAuthClientSrc, sbAuthErrSrc = supabase.NewClient(url, key, &supabase.ClientOptions{Schema: "next_auth"})
+	})
+	if sbAuthErrSrc != nil {
+		return nil, sbAuthErrSrc
+	}
+	return sbAuthClientSrc, nil
+}
+
+// SetStoreForTests makes GetStore return s until the next reset.
+func SetStoreForTests(s store.Store) {
+	storeOnce = sync.Once{}
+	storeOnce.Do(func() {})
+	storeSrc = s
+	storeErr = nil
+}
+
+// ResetSupabaseForTests clears the cached clients and store for tests.
 func ResetSupabaseForTests() {
+	storeSrc = nil
+	storeErr = nil
+	storeOnce = sync.Once{}
 	sbClientSrc = nil
 	sbErrSrc = nil
 	sbOnceSrc = sync.Once{}
+	sbAuthClientSrc = nil
+	sbAuthErrSrc = nil
+	sbAuthOnceSrc = sync.Once{}
 }
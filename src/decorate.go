@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/et-hicks/imitation-backend/models"
+	"github.com/et-hicks/imitation-backend/store"
+)
+
+// writtenTweet is the response to creating or editing a tweet: the stored
+// row with its entities.
+type writtenTweet struct {
+	models.Tweet
+	Entities models.Entities `json:"entities"`
+}
+
+// writtenComment is writtenTweet for comments.
+type writtenComment struct {
+	models.Comment
+	Entities models.Entities `json:"entities"`
+}
+
+// entitiesOf returns the entities of a body with its mentions resolved.
+func entitiesOf(ctx context.Context, st store.Store, body string) (models.Entities, error) {
+	var deco decorator
+	var e models.Entities
+	deco.addBody(body, &e)
+	return e, deco.fill(ctx, st)
+}
+
+// checkMentions writes a 400 naming the mentioned usernames in body that
+// belong to no user.
+func checkMentions(w http.ResponseWriter, ctx context.Context, st store.Store, body string) bool {
+	names := models.MentionedUsernames(body)
+	if len(names) == 0 {
+		return true
+	}
+	users, err := st.UsersByUsername(ctx, names)
+	if err != nil {
+		writeError(w, err)
+		return false
+	}
+	var unknown []string
+	for _, name := range names {
+		if _, ok := users[name]; !ok {
+			unknown = append(unknown, "@"+name)
+		}
+	}
+	if len(unknown) > 0 {
+		writeError(w, validationFailed("unknown user "+strings.Join(unknown, ", ")))
+		return false
+	}
+	return true
+}
+
+// decorator collects the tweets and comments of a response to fill in what
+// the store does not return: their entities, with mentions resolved from one
+// lookup, and, on authenticated requests, the viewer's interaction state from
+// another.
+type decorator struct {
+	bodies   []string
+	entities []*models.Entities
+	targets  []store.Target
+	slots    []**models.ViewerState
+}
+
+func (d *decorator) addTweet(t *models.TweetWithUser) {
+	d.addBody(t.Body, &t.Entities)
+	d.add(store.Target{ID: t.ID}, &t.Viewer)
+}
+
+func (d *decorator) addTweets(tweets []models.TweetWithUser) {
+	for i := range tweets {
+		d.addTweet(&tweets[i])
+	}
+}
+
+func (d *decorator) addFeed(items []models.FeedItem) {
+	for i := range items {
+		d.addTweet(&items[i].TweetWithUser)
+	}
+}
+
+func (d *decorator) addSaved(saved []models.SavedTweet) {
+	for i := range saved {
+		d.addTweet(&saved[i].TweetWithUser)
+	}
+}
+
+func (d *decorator) addComment(c *models.CommentWithUser) {
+	d.addBody(c.Body, &c.Entities)
+	d.add(store.Target{ID: c.ID, IsComment: true}, &c.Viewer)
+}
+
+func (d *decorator) addComments(comments []models.CommentWithUser) {
+	for i := range comments {
+		d.addComment(&comments[i])
+	}
+}
+
+func (d *decorator) addLiked(items []models.LikedItem) {
+	for _, item := range items {
+		if item.Tweet != nil {
+			d.addTweet(item.Tweet)
+		}
+		if item.Comment != nil {
+			d.addComment(item.Comment)
+		}
+	}
+}
+
+func (d *decorator) addMentions(items []models.MentionItem) {
+	for _, item := range items {
+		if item.Tweet != nil {
+			d.addTweet(item.Tweet)
+		}
+		if item.Comment != nil {
+			d.addComment(item.Comment)
+		}
+	}
+}
+
+func (d *decorator) addNotifications(items []models.Notification) {
+	for _, item := range items {
+		if item.Tweet != nil {
+			d.addTweet(item.Tweet)
+		}
+		if item.Comment != nil {
+			d.addComment(item.Comment)
+		}
+	}
+}
+
+func (d *decorator) addThread(thread *models.CommentThread) {
+	d.addComment(&thread.CommentWithUser)
+	for i := range thread.Children {
+		d.addThread(&thread.Children[i])
+	}
+}
+
+func (d *decorator) addBody(body string, entities *models.Entities) {
+	d.bodies = append(d.bodies, body)
+	d.entities = append(d.entities, entities)
+}
+
+func (d *decorator) add(target store.Target, slot **models.ViewerState) {
+	d.targets = append(d.targets, target)
+	d.slots = append(d.slots, slot)
+}
+
+// fill decorates every collected item. Mentions of unknown usernames are left
+// out of the entities. Anonymous requests get no viewer state, so their
+// payloads carry no viewer field.
+func (d *decorator) fill(ctx context.Context, st store.Store) error {
+	if err := d.fillEntities(ctx, st); err != nil {
+		return err
+	}
+	viewerID, ok := UserIDFromContext(ctx)
+	if !ok || len(d.targets) == 0 {
+		return nil
+	}
+	states, err := st.ViewerStates(ctx, viewerID, d.targets)
+	if err != nil {
+		return err
+	}
+	for i, target := range d.targets {
+		state := states[target]
+		*d.slots[i] = &state
+	}
+	return nil
+}
+
+func (d *decorator) fillEntities(ctx context.Context, st store.Store) error {
+	var names []string
+	for i, body := range d.bodies {
+		*d.entities[i] = models.ExtractEntities(body)
+		for _, m := range d.entities[i].Mentions {
+			names = append(names, m.Username)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	users, err := st.UsersByUsername(ctx, names)
+	if err != nil {
+		return err
+	}
+	for _, e := range d.entities {
+		resolved := e.Mentions[:0]
+		for _, m := range e.Mentions {
+			if u, ok := users[m.Username]; ok {
+				m.Username, m.UserID = u.Username, u.ID
+				resolved = append(resolved, m)
+			}
+		}
+		e.Mentions = resolved
+	}
+	return nil
+}
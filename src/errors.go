@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/et-hicks/imitation-backend/store"
+)
+
+// Error codes name the kind of failure in error responses. Clients may
+// switch on them; the messages are for people and may change.
+const (
+	codeValidationFailed = "validation_failed"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeConflict         = "conflict"
+	codeInternal         = "internal"
+)
+
+// apiError is an error to report to the client. writeError sends it with
+// Status as the response status and a body of
+//
+//	{"error": {"code": "not_found", "message": "tweet not found"}}
+//
+// Validation failures also list the fields at fault under "fields".
+type apiError struct {
+	Status  int          `json:"-"`
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []fieldError `json:"fields,omitempty"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// validationFailed reports a request that is malformed or breaks a rule.
+func validationFailed(message string) *apiError {
+	return &apiError{Status: http.StatusBadRequest, Code: codeValidationFailed, Message: message}
+}
+
+// unauthorized reports a request that needs a signed-in caller.
+func unauthorized(message string) *apiError {
+	return &apiError{Status: http.StatusUnauthorized, Code: codeUnauthorized, Message: message}
+}
+
+// forbidden reports a request the caller may not make.
+func forbidden(message string) *apiError {
+	return &apiError{Status: http.StatusForbidden, Code: codeForbidden, Message: message}
+}
+
+// notFound reports a request for something that does not exist.
+func notFound(message string) *apiError {
+	return &apiError{Status: http.StatusNotFound, Code: codeNotFound, Message: message}
+}
+
+// conflict reports a request that clashes with existing data.
+func conflict(message string) *apiError {
+	return &apiError{Status: http.StatusConflict, Code: codeConflict, Message: message}
+}
+
+// statusCodes are the error codes of the statuses apiErrors are sent with.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:       codeValidationFailed,
+	http.StatusUnauthorized:     codeUnauthorized,
+	http.StatusForbidden:        codeForbidden,
+	http.StatusNotFound:         codeNotFound,
+	http.StatusMethodNotAllowed: codeMethodNotAllowed,
+	http.StatusConflict:         codeConflict,
+}
+
+// statusError reports a client error that arrives as a bare status and
+// message, such as a failed WebSocket handshake, with the code for status.
+// Other client errors are validation failures.
+func statusError(status int, message string) *apiError {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = codeValidationFailed
+	}
+	return &apiError{Status: status, Code: code, Message: message}
+}
+
+// writeError reports err to the client. An *apiError is sent as it is, and
+// the store's ErrNotFound, ErrForbidden and ErrConflict with their codes and
+// a generic message. Any other error is logged and answered with a 500 that
+// does not repeat it, since database errors can name tables, queries and
+// constraints.
+func writeError(w http.ResponseWriter, err error) {
+	var e *apiError
+	switch {
+	case errors.As(err, &e):
+	case errors.Is(err, store.ErrNotFound):
+		e = notFound("not found")
+	case errors.Is(err, store.ErrForbidden):
+		e = forbidden("forbidden")
+	case errors.Is(err, store.ErrConflict):
+		e = conflict("conflict")
+	default:
+		log.Println("internal error:", err)
+		e = &apiError{Status: http.StatusInternalServerError, Code: codeInternal, Message: "internal server error"}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error *apiError `json:"error"`
+	}{e})
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/et-hicks/imitation-backend/store"
+)
+
+// eventBacklog is how many recent events the hub keeps for clients that
+// reconnect with the id of the last event they saw.
+const eventBacklog = 256
+
+// Event types.
+const (
+	eventTweet        = "tweet"
+	eventComment      = "comment"
+	eventCommentCount = "comment_count"
+	eventInteraction  = "interaction"
+	eventReset        = "reset"
+)
+
+// event is a change pushed to live clients. Ids increase by one per event
+// published since the process started.
+type event struct {
+	ID   int64
+	Type string
+	Data json.RawMessage
+	// TweetID is the tweet the event concerns and UserID the user who caused
+	// it, when there are such.
+	TweetID int
+	UserID  int
+	// Audience, when set, limits the event to that user's connections.
+	Audience int
+}
+
+// visibleTo reports whether viewerID, 0 when anonymous, may see e.
+func (e event) visibleTo(viewerID int) bool {
+	return e.Audience == 0 || e.Audience == viewerID
+}
+
+// subscriber receives the events visible to its viewer that it wants. The
+// hub closes events when the subscriber falls a full buffer behind; it can
+// catch up by subscribing again from the last event it handled.
+type subscriber struct {
+	viewerID int
+	// wants, when set, picks the events to deliver. The hub calls it with its
+	// lock held.
+	wants  func(event) bool
+	events chan event
+}
+
+// accepts reports whether s should receive e.
+func (s *subscriber) accepts(e event) bool {
+	return e.visibleTo(s.viewerID) && (s.wants == nil || s.wants(e))
+}
+
+// hub fans events out to subscribers in process.
+type hub struct {
+	mu      sync.Mutex
+	lastID  int64
+	backlog []event
+	subs    map[*subscriber]struct{}
+}
+
+func newHub() *hub {
+	return &hub{subs: map[*subscriber]struct{}{}}
+}
+
+// liveEvents carries the changes made through this process's handlers.
+var liveEvents = newHub()
+
+// publish stamps e with the next id and delivers it.
+func (h *hub) publish(e event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID++
+	e.ID = h.lastID
+	h.backlog = append(h.backlog, e)
+	if len(h.backlog) > eventBacklog {
+		h.backlog = h.backlog[len(h.backlog)-eventBacklog:]
+	}
+	for s := range h.subs {
+		if !s.accepts(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			close(s.events)
+			delete(h.subs, s)
+		}
+	}
+}
+
+// subscribe registers a subscriber with room for buffer undelivered events,
+// taking those wants picks, or all when it is nil. When after is set it also
+// returns the events for it published since the event with that id. If some
+// of those are no longer kept, or the id comes from before the process
+// started, it returns a single reset event instead, telling the client to
+// reload.
+func (h *hub) subscribe(viewerID int, wants func(event) bool, buffer int, after *int64) (*subscriber, []event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := &subscriber{viewerID: viewerID, wants: wants, events: make(chan event, buffer)}
+	h.subs[s] = struct{}{}
+	if after == nil {
+		return s, nil
+	}
+	if *after > h.lastID || (len(h.backlog) > 0 && *after < h.backlog[0].ID-1) {
+		return s, []event{{ID: h.lastID, Type: eventReset, Data: json.RawMessage("{}")}}
+	}
+	var missed []event
+	for _, e := range h.backlog {
+		if e.ID > *after && s.accepts(e) {
+			missed = append(missed, e)
+		}
+	}
+	return s, missed
+}
+
+// unsubscribe removes s if the hub has not already dropped it.
+func (h *hub) unsubscribe(s *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[s]; ok {
+		close(s.events)
+		delete(h.subs, s)
+	}
+}
+
+// publishEvent publishes data as an event of type typ to everyone, or only
+// to audience when it is not 0.
+func publishEvent(typ string, data any, tweetID, userID, audience int) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Println("publish", typ, "event:", err)
+		return
+	}
+	liveEvents.publish(event{Type: typ, Data: raw, TweetID: tweetID, UserID: userID, Audience: audience})
+}
+
+// publishComment publishes a comment userID just wrote, then the new
+// counters of its tweet.
+func publishComment(ctx context.Context, st store.Store, comment writtenComment, userID int) {
+	publishEvent(eventComment, comment, comment.TweetID, userID, 0)
+	publishCommentCount(ctx, st, comment.TweetID, userID)
+}
+
+// commentCountEvent carries a tweet's comment counters after a comment.
+type commentCountEvent struct {
+	TweetID  int `json:"tweet_id"`
+	Comments int `json:"comments"`
+	Replies  int `json:"replies"`
+}
+
+// publishCommentCount publishes the counters of tweetID after userID
+// commented on it.
+func publishCommentCount(ctx context.Context, st store.Store, tweetID, userID int) {
+	tweet, err := st.GetTweet(ctx, tweetID)
+	if err != nil {
+		log.Println("publish comment count:", err)
+		return
+	}
+	publishEvent(eventCommentCount, commentCountEvent{
+		TweetID:  tweet.ID,
+		Comments: tweet.Comments,
+		Replies:  tweet.Replies,
+	}, tweet.ID, userID, 0)
+}
+
+// interactionEvent reports a like, save, restack or follow turning on or
+// off. A comment target carries the id of its tweet too. Count is the
+// target's new count of that interaction, when it could be read.
+type interactionEvent struct {
+	UserID     int    `json:"user_id"`
+	Kind       string `json:"kind"`
+	Active     bool   `json:"active"`
+	TweetID    *int   `json:"tweet_id,omitempty"`
+	CommentID  *int   `json:"comment_id,omitempty"`
+	FollowedID *int   `json:"followed_id,omitempty"`
+	Count      *int   `json:"count,omitempty"`
+}
+
+var interactionKinds = map[store.Interaction]string{
+	store.Like:    "like",
+	store.Save:    "save",
+	store.Restack: "restack",
+}
+
+// publishInteraction publishes userID's change of kind on target. Saves are
+// private, so only userID's own connections hear of them.
+func publishInteraction(ctx context.Context, st store.Store, userID int, target store.Target, kind store.Interaction, active bool) {
+	e := interactionEvent{UserID: userID, Kind: interactionKinds[kind], Active: active}
+	var count int
+	if target.IsComment {
+		e.CommentID = &target.ID
+		if thread, err := st.CommentThread(ctx, target.ID, 0); err != nil {
+			log.Println("publish interaction:", err)
+		} else {
+			e.TweetID, count = &thread.TweetID, thread.Likes
+			e.Count = &count
+		}
+	} else {
+		e.TweetID = &target.ID
+		if tweet, err := st.GetTweet(ctx, target.ID); err != nil {
+			log.Println("publish interaction:", err)
+		} else {
+			switch kind {
+			case store.Like:
+				count = tweet.Likes
+			case store.Save:
+				count = tweet.Saves
+			case store.Restack:
+				count = tweet.Restacks
+			}
+			e.Count = &count
+		}
+	}
+	audience, tweetID := 0, 0
+	if kind == store.Save {
+		audience = userID
+	}
+	if e.TweetID != nil {
+		tweetID = *e.TweetID
+	}
+	publishEvent(eventInteraction, e, tweetID, userID, audience)
+}
+
+// publishFollow publishes userID following or unfollowing followID.
+func publishFollow(userID, followID int, active bool) {
+	publishEvent(eventInteraction, interactionEvent{
+		UserID:     userID,
+		Kind:       "follow",
+		Active:     active,
+		FollowedID: &followID,
+	}, 0, userID, 0)
+}
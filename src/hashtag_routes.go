@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/et-hicks/imitation-backend/models"
+)
+
+func init() {
+	route("GET /hashtag/{tag}", hashtagHandler)
+}
+
+// hashtagHandler returns a page of the newest tweets tagged with the hashtag
+// in the path, given with or without its "#" (URL-encoded as %23).
+func hashtagHandler(w http.ResponseWriter, r *http.Request, p pathParams) {
+	log.Println("inilizied request")
+	tag, ok := models.NormalizeHashtag(p.String("tag"))
+	if !ok {
+		writeError(w, validationFailed("invalid hashtag"))
+		return
+	}
+	page, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	tweets, err := st.HashtagTweets(ctx, tag, page)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var deco decorator
+	deco.addTweets(tweets)
+	if err := deco.fill(ctx, st); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, page, tweets, tweetCursor)
+	log.Println("sent successfully")
+}
@@ -2,41 +2,78 @@ package api
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"net/http"
 	"time"
-
-	postgrest "github.com/supabase-community/postgrest-go"
 )
 
 func init() {
-	http.HandleFunc("/home", homeHandler)
+	route("GET /home", homeHandler)
 }
 
-// homeHandler returns the 10 most recent tweets with user information.
-func homeHandler(w http.ResponseWriter, r *http.Request) {
+// homeHandler returns a page of the home timeline. The mode query parameter
+// selects it: "following" is the tweets and restacks of the accounts the
+// viewer follows and requires authentication, while "latest" (or its alias
+// "explore") is the newest tweets from everyone and is the default.
+func homeHandler(w http.ResponseWriter, r *http.Request, _ pathParams) {
 	log.Println("inilizied request")
+	page, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "latest"
+	}
+	if mode != "following" && mode != "latest" && mode != "explore" {
+		writeError(w, validationFailed("mode must be following, latest or explore"))
+		return
+	}
+
 	ctx := r.Context()
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	client, err := GetSupabase(ctx)
+	st, err := GetStore(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+
+	if mode == "following" {
+		viewerID, ok := requireUser(w, r)
+		if !ok {
+			return
+		}
+		items, err := st.FollowingTimeline(ctx, viewerID, page)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		var deco decorator
+		deco.addFeed(items)
+		if err := deco.fill(ctx, st); err != nil {
+			writeError(w, err)
+			return
+		}
+		writePage(w, page, items, feedCursor)
+		log.Println("sent successfully")
 		return
 	}
 
-	var tweets []TweetWithUser
-	qb := client.From("tweets").Select("*,users(*)", "", false)
-	qb = qb.Order("created_at", &postgrest.OrderOpts{Ascending: false})
-	qb = qb.Limit(10, "")
-	if _, err := qb.ExecuteTo(&tweets); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	tweets, err := st.LatestTweets(ctx, page)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var deco decorator
+	deco.addTweets(tweets)
+	if err := deco.fill(ctx, st); err != nil {
+		writeError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(tweets)
+	writePage(w, page, tweets, tweetCursor)
 	log.Println("sent successfully")
 }
@@ -2,236 +2,176 @@ package api
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
-	postgrest "github.com/supabase-community/postgrest-go"
+	"github.com/et-hicks/imitation-backend/models"
+	"github.com/et-hicks/imitation-backend/store"
 )
 
 func init() {
-	http.HandleFunc("/like/", likeHandler)
-	http.HandleFunc("/save/", saveHandler)
-	http.HandleFunc("/restack/", restackHandler)
-	http.HandleFunc("/follow/", followHandler)
+	route("PUT /like/{user_id:int}/{target_id:int}", likeHandler)
+	route("PUT /save/{user_id:int}/{tweet_id:int}", saveHandler)
+	route("PUT /restack/{user_id:int}/{tweet_id:int}", restackHandler)
+	route("PUT /follow/{user_id:int}/{follow_id:int}", followHandler)
 }
 
-func likeHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.NotFound(w, r)
-		return
-	}
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) != 3 {
-		http.NotFound(w, r)
-		return
-	}
-	userIDStr, targetIDStr := parts[1], parts[2]
-	if r.Header.Get("Authorization") != userIDStr {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+func likeHandler(w http.ResponseWriter, r *http.Request, p pathParams) {
+	userID, ok := requireSelf(w, r, p.Int("user_id"))
+	if !ok {
 		return
 	}
 	isCommentStr := r.Header.Get("Is-Comment")
 	if isCommentStr == "" {
-		http.Error(w, "missing Is-Comment header", http.StatusBadRequest)
+		writeError(w, validationFailed("missing Is-Comment header"))
 		return
 	}
 	isComment := strings.ToLower(isCommentStr) == "true"
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		http.Error(w, "invalid user id", http.StatusBadRequest)
-		return
-	}
-	targetID, err := strconv.Atoi(targetIDStr)
-	if err != nil {
-		http.Error(w, "invalid target id", http.StatusBadRequest)
-		return
-	}
 	remove := strings.ToLower(r.URL.Query().Get("remove")) == "true"
 	ctx := r.Context()
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	client, err := GetSupabase(ctx)
+	st, err := GetStore(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
-	var qb *postgrest.FilterBuilder
-	if remove {
-		updatePayload := map[string]interface{}{"is_liked": false}
-		qb = client.From("user_tweet_interactions").Update(updatePayload, "", "")
-		qb = qb.Eq("user_id", userIDStr)
-		if isComment {
-			qb = qb.Eq("comment_id", targetIDStr)
-		} else {
-			qb = qb.Eq("tweet_id", targetIDStr)
-		}
-	} else {
-		payload := map[string]interface{}{
-			"user_id":  userID,
-			"is_liked": true,
-		}
-		if isComment {
-			payload["comment_id"] = targetID
-		} else {
-			payload["tweet_id"] = targetID
-		}
-		qb = client.From("user_tweet_interactions").Insert(payload, true, "user_id,tweet_id,comment_id", "", "")
-	}
-	if _, _, err := qb.Execute(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	target := store.Target{ID: p.Int("target_id"), IsComment: isComment}
+	changed, err := st.SetInteraction(ctx, userID, target, store.Like, !remove)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
+	if changed {
+		publishInteraction(ctx, st, userID, target, store.Like, !remove)
+	}
 	w.WriteHeader(http.StatusNoContent)
 	log.Println("sent successfully")
 }
 
-func saveHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.NotFound(w, r)
-		return
-	}
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) != 3 {
-		http.NotFound(w, r)
-		return
-	}
-	userIDStr, tweetIDStr := parts[1], parts[2]
-	if r.Header.Get("Authorization") != userIDStr {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		http.Error(w, "invalid user id", http.StatusBadRequest)
-		return
-	}
-	tweetID, err := strconv.Atoi(tweetIDStr)
-	if err != nil {
-		http.Error(w, "invalid tweet id", http.StatusBadRequest)
+func saveHandler(w http.ResponseWriter, r *http.Request, p pathParams) {
+	userID, ok := requireSelf(w, r, p.Int("user_id"))
+	if !ok {
 		return
 	}
+	tweetID := p.Int("tweet_id")
 	remove := strings.ToLower(r.URL.Query().Get("remove")) == "true"
+	// folder files the save into one of the caller's bookmark folders, or
+	// takes it out of its folder when "none".
+	var folderID *int
+	folder := r.URL.Query().Get("folder")
+	fileIn := folder != ""
+	if fileIn && folder != "none" {
+		id, err := strconv.Atoi(folder)
+		if err != nil {
+			writeError(w, validationFailed("invalid folder id"))
+			return
+		}
+		folderID = &id
+	}
 	ctx := r.Context()
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	client, err := GetSupabase(ctx)
+	st, err := GetStore(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
-	var qb *postgrest.FilterBuilder
-	if remove {
-		updatePayload := map[string]interface{}{"is_saved": false}
-		qb = client.From("user_tweet_interactions").Update(updatePayload, "", "")
-		qb = qb.Eq("user_id", userIDStr).Eq("tweet_id", tweetIDStr)
-	} else {
-		payload := map[string]interface{}{
-			"user_id":  userID,
-			"tweet_id": tweetID,
-			"is_saved": true,
+	// Check the folder before saving, so that a bad folder leaves the tweet
+	// as it was.
+	if folderID != nil && !remove {
+		folders, err := st.BookmarkFolders(ctx, userID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !slices.ContainsFunc(folders, func(f models.BookmarkFolder) bool { return f.ID == *folderID }) {
+			writeError(w, notFound("folder not found"))
+			return
 		}
-		qb = client.From("user_tweet_interactions").Insert(payload, true, "user_id,tweet_id,comment_id", "", "")
 	}
-	if _, _, err := qb.Execute(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	target := store.Target{ID: tweetID}
+	changed, err := st.SetInteraction(ctx, userID, target, store.Save, !remove)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
+	if fileIn && !remove {
+		err := st.FileSave(ctx, userID, tweetID, folderID)
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, notFound("folder not found"))
+			return
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	if changed {
+		publishInteraction(ctx, st, userID, target, store.Save, !remove)
+	}
 	w.WriteHeader(http.StatusNoContent)
 	log.Println("sent successfully")
 }
 
-func restackHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.NotFound(w, r)
-		return
-	}
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) != 3 {
-		http.NotFound(w, r)
-		return
-	}
-	userIDStr, tweetIDStr := parts[1], parts[2]
-	if r.Header.Get("Authorization") != userIDStr {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		http.Error(w, "invalid user id", http.StatusBadRequest)
-		return
-	}
-	tweetID, err := strconv.Atoi(tweetIDStr)
-	if err != nil {
-		http.Error(w, "invalid tweet id", http.StatusBadRequest)
+func restackHandler(w http.ResponseWriter, r *http.Request, p pathParams) {
+	userID, ok := requireSelf(w, r, p.Int("user_id"))
+	if !ok {
 		return
 	}
+	tweetID := p.Int("tweet_id")
+	remove := strings.ToLower(r.URL.Query().Get("remove")) == "true"
 	ctx := r.Context()
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	client, err := GetSupabase(ctx)
+	st, err := GetStore(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
-	payload := map[string]interface{}{
-		"user_id":      userID,
-		"tweet_id":     tweetID,
-		"is_restacked": true,
-	}
-	qb := client.From("user_tweet_interactions").Insert(payload, true, "user_id,tweet_id,comment_id", "", "")
-	if _, _, err := qb.Execute(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	target := store.Target{ID: tweetID}
+	changed, err := st.SetInteraction(ctx, userID, target, store.Restack, !remove)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
+	if changed {
+		publishInteraction(ctx, st, userID, target, store.Restack, !remove)
+	}
 	w.WriteHeader(http.StatusNoContent)
 	log.Println("sent successfully")
 }
 
-func followHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.NotFound(w, r)
-		return
-	}
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) != 3 {
-		http.NotFound(w, r)
-		return
-	}
-	userIDStr, followIDStr := parts[1], parts[2]
-	if r.Header.Get("Authorization") != userIDStr {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		http.Error(w, "invalid user id", http.StatusBadRequest)
-		return
-	}
-	followID, err := strconv.Atoi(followIDStr)
-	if err != nil {
-		http.Error(w, "invalid follow id", http.StatusBadRequest)
+func followHandler(w http.ResponseWriter, r *http.Request, p pathParams) {
+	userID, ok := requireSelf(w, r, p.Int("user_id"))
+	if !ok {
 		return
 	}
+	followID := p.Int("follow_id")
+	remove := strings.ToLower(r.URL.Query().Get("remove")) == "true"
 	ctx := r.Context()
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	client, err := GetSupabase(ctx)
+	st, err := GetStore(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
-	payload := map[string]interface{}{
-		"user_id":           userID,
-		"following_user_id": followID,
+	if remove {
+		err = st.Unfollow(ctx, userID, followID)
+	} else {
+		err = st.Follow(ctx, userID, followID)
 	}
-	qb := client.From("user_following").Insert(payload, true, "user_id,following_user_id", "", "")
-	if _, _, err := qb.Execute(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
+	publishFollow(userID, followID, !remove)
 	w.WriteHeader(http.StatusNoContent)
 	log.Println("sent successfully")
 }
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/et-hicks/imitation-backend/models"
+)
+
+func init() {
+	route("GET /notifications", notificationsHandler)
+	route("POST /notifications/read", markNotificationsRead)
+}
+
+// notificationsResponse is a page of notifications with the caller's count of
+// unread ones.
+type notificationsResponse struct {
+	pageResponse[models.Notification]
+	UnreadCount int `json:"unread_count"`
+}
+
+// notificationsHandler returns a page of the caller's notifications, most
+// recently updated first.
+func notificationsHandler(w http.ResponseWriter, r *http.Request, _ pathParams) {
+	log.Println("inilizied request")
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	page, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	items, err := st.Notifications(ctx, userID, page)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	unread, err := st.UnreadNotifications(ctx, userID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var deco decorator
+	deco.addNotifications(items)
+	if err := deco.fill(ctx, st); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(notificationsResponse{
+		pageResponse: newPageResponse(page, items, notificationCursor),
+		UnreadCount:  unread,
+	})
+	log.Println("sent successfully")
+}
+
+// markNotificationsRead marks the notifications listed in the ids of the
+// request body read, or all of the caller's notifications when the body has
+// no ids.
+func markNotificationsRead(w http.ResponseWriter, r *http.Request, _ pathParams) {
+	log.Println("inilizied request")
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var payload struct {
+		IDs []int `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, validationFailed("invalid JSON body"))
+		return
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := st.MarkNotificationsRead(ctx, userID, payload.IDs); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Println("sent successfully")
+}
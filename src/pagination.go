@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/et-hicks/imitation-backend/models"
+	"github.com/et-hicks/imitation-backend/store"
+)
+
+const (
+	defaultPageLimit = 10
+	maxPageLimit     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pageResponse is the envelope for paginated listings. NextCursor is null on
+// the last page.
+type pageResponse[T any] struct {
+	Data       []T     `json:"data"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// encodeCursor renders a keyset position as an opaque token.
+func encodeCursor(c store.Cursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(c.ID)
+	if c.RestackedBy != 0 {
+		raw += "|" + strconv.Itoa(c.RestackedBy)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a token produced by encodeCursor.
+func decodeCursor(token string) (store.Cursor, error) {
+	var c store.Cursor
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return c, errInvalidCursor
+	}
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+		return c, errInvalidCursor
+	}
+	id, by, hasBy := strings.Cut(id, "|")
+	if c.ID, err = strconv.Atoi(id); err != nil {
+		return c, errInvalidCursor
+	}
+	if hasBy {
+		if c.RestackedBy, err = strconv.Atoi(by); err != nil || c.RestackedBy < 1 {
+			return c, errInvalidCursor
+		}
+	}
+	return c, nil
+}
+
+// parsePage reads the limit and cursor query parameters, writing a 400 when
+// either is malformed. The returned page asks for one extra row so writePage
+// can tell whether another page follows.
+func parsePage(w http.ResponseWriter, r *http.Request) (store.Page, bool) {
+	q := r.URL.Query()
+	page := store.Page{Limit: defaultPageLimit}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageLimit {
+			writeError(w, validationFailed("limit must be between 1 and "+strconv.Itoa(maxPageLimit)))
+			return page, false
+		}
+		page.Limit = n
+	}
+	if s := q.Get("cursor"); s != "" {
+		c, err := decodeCursor(s)
+		if err != nil {
+			writeError(w, validationFailed(err.Error()))
+			return page, false
+		}
+		page.Before = &c
+	}
+	page.Limit++
+	return page, true
+}
+
+// newPageResponse trims items fetched with a parsePage page back to the
+// requested size, setting the cursor of the last row when more remain.
+func newPageResponse[T any](page store.Page, items []T, key func(T) store.Cursor) pageResponse[T] {
+	resp := pageResponse[T]{Data: items}
+	if resp.Data == nil {
+		resp.Data = []T{}
+	}
+	if limit := page.Limit - 1; len(items) > limit {
+		resp.Data = items[:limit]
+		next := encodeCursor(key(resp.Data[limit-1]))
+		resp.NextCursor = &next
+	}
+	return resp
+}
+
+// writePage writes the newPageResponse for items.
+func writePage[T any](w http.ResponseWriter, page store.Page, items []T, key func(T) store.Cursor) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newPageResponse(page, items, key))
+}
+
+func tweetCursor(t models.TweetWithUser) store.Cursor {
+	return store.Cursor{CreatedAt: t.CreatedAt, ID: t.ID}
+}
+
+func commentCursor(c models.CommentWithUser) store.Cursor {
+	return store.Cursor{CreatedAt: c.CreatedAt, ID: c.ID}
+}
+
+func feedCursor(item models.FeedItem) store.Cursor {
+	c := store.Cursor{CreatedAt: item.FeedAt, ID: item.ID}
+	if item.RestackedBy != nil {
+		c.RestackedBy = item.RestackedBy.ID
+	}
+	return c
+}
+
+func followCursor(e models.FollowEntry) store.Cursor {
+	return store.Cursor{CreatedAt: e.FollowedAt, ID: e.ID}
+}
+
+func revisionCursor(r models.Revision) store.Cursor {
+	return store.Cursor{CreatedAt: r.CreatedAt, ID: r.ID}
+}
+
+func savedCursor(s models.SavedTweet) store.Cursor {
+	return store.Cursor{CreatedAt: s.SavedAt, ID: s.ID}
+}
+
+func likedCursor(l models.LikedItem) store.Cursor {
+	return store.Cursor{CreatedAt: l.LikedAt, ID: l.ID}
+}
+
+func mentionCursor(m models.MentionItem) store.Cursor {
+	return store.Cursor{CreatedAt: m.MentionedAt, ID: m.ID}
+}
+
+func interactionCursor(e models.InteractionEntry) store.Cursor {
+	return store.Cursor{CreatedAt: e.InteractedAt, ID: e.ID}
+}
+
+func notificationCursor(n models.Notification) store.Cursor {
+	return store.Cursor{CreatedAt: n.UpdatedAt, ID: n.ID}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// apiVersion prefixes every API route. The same routes stay mounted without
+// it for clients written before the API was versioned.
+const apiVersion = "/v1"
+
+// allowOrder lists the methods routes may serve, in the order a 405's Allow
+// header names them.
+var allowOrder = []string{
+	http.MethodDelete,
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPatch,
+	http.MethodPost,
+	http.MethodPut,
+}
+
+func init() {
+	http.HandleFunc("/", noRoute)
+}
+
+// noRoute answers the requests no route matches: with a 405 when the path
+// has routes for other methods, listed in the Allow header, and a 404
+// otherwise.
+func noRoute(w http.ResponseWriter, r *http.Request) {
+	var allow []string
+	for _, method := range allowOrder {
+		probe := r.WithContext(r.Context())
+		probe.Method = method
+		if _, pattern := http.DefaultServeMux.Handler(probe); pattern != "" && pattern != "/" {
+			allow = append(allow, method)
+		}
+	}
+	if len(allow) == 0 {
+		writeError(w, notFound("no such route"))
+		return
+	}
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	writeError(w, &apiError{
+		Status:  http.StatusMethodNotAllowed,
+		Code:    codeMethodNotAllowed,
+		Message: r.Method + " is not allowed here",
+	})
+}
+
+// pathParams are the path parameters of a matched route, parsed as its
+// pattern declares them.
+type pathParams struct {
+	r    *http.Request
+	ints map[string]int
+}
+
+// Int returns the {name:int} parameter.
+func (p pathParams) Int(name string) int {
+	return p.ints[name]
+}
+
+// String returns the {name} parameter, unescaped.
+func (p pathParams) String(name string) string {
+	return p.r.PathValue(name)
+}
+
+// routeHandler handles a request to a route with its path parameters.
+type routeHandler func(w http.ResponseWriter, r *http.Request, p pathParams)
+
+// typedParam matches a "{name:type}" path segment.
+var typedParam = regexp.MustCompile(`\{(\w+):(\w+)\}`)
+
+// route registers h for pattern, a method and a path such as
+// "GET /tweet/{tweet_id:int}", under apiVersion and at the bare path. A
+// {name:int} parameter must be an integer, or the request gets a 400 saying
+// "invalid" and the name with underscores as spaces, such as "invalid tweet
+// id"; a plain {name} matches any segment. Requests for a registered path
+// with a method it does not serve get a 405 from noRoute.
+func route(pattern string, h routeHandler) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok || !strings.HasPrefix(path, "/") {
+		panic(fmt.Sprintf("route %q: want a method and a path", pattern))
+	}
+	var ints []string
+	path = typedParam.ReplaceAllStringFunc(path, func(segment string) string {
+		m := typedParam.FindStringSubmatch(segment)
+		if m[2] != "int" {
+			panic(fmt.Sprintf("route %q: unknown parameter type %q", pattern, m[2]))
+		}
+		ints = append(ints, m[1])
+		return "{" + m[1] + "}"
+	})
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		p := pathParams{r: r, ints: make(map[string]int, len(ints))}
+		for _, name := range ints {
+			n, err := strconv.Atoi(r.PathValue(name))
+			if err != nil {
+				writeError(w, validationFailed("invalid "+strings.ReplaceAll(name, "_", " ")))
+				return
+			}
+			p.ints[name] = n
+		}
+		h(w, r, p)
+	}
+	http.HandleFunc(method+" "+apiVersion+path, handler)
+	http.HandleFunc(method+" "+path, handler)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/et-hicks/imitation-backend/models"
+	"github.com/et-hicks/imitation-backend/store"
+)
+
+func init() {
+	route("GET /search", searchHandler)
+}
+
+// searchResponse holds the ranked results of each searched kind. NextOffset
+// is null once no kind has further results.
+type searchResponse struct {
+	Tweets     []models.TweetWithUser   `json:"tweets"`
+	Comments   []models.CommentWithUser `json:"comments"`
+	Users      []models.User            `json:"users"`
+	NextOffset *int                     `json:"next_offset"`
+}
+
+// searchHandler runs a full-text search. The q query parameter takes words,
+// "quoted phrases" and the operators from:username, before:YYYY-MM-DD,
+// after:YYYY-MM-DD and has:replies. type limits the search to tweets,
+// comments or users, and limit and offset page through the ranked results.
+func searchHandler(w http.ResponseWriter, r *http.Request, _ pathParams) {
+	log.Println("inilizied request")
+	params := r.URL.Query()
+
+	q, err := store.ParseSearchQuery(params.Get("q"))
+	if errors.Is(err, store.ErrEmptySearch) {
+		writeError(w, validationFailed("missing q"))
+		return
+	}
+	if err != nil {
+		writeError(w, validationFailed(err.Error()))
+		return
+	}
+
+	kind := params.Get("type")
+	if kind != "" && kind != "all" && kind != "tweets" && kind != "comments" && kind != "users" {
+		writeError(w, validationFailed("type must be all, tweets, comments or users"))
+		return
+	}
+	limit := defaultPageLimit
+	if s := params.Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			writeError(w, validationFailed("limit must be between 1 and "+strconv.Itoa(maxPageLimit)))
+			return
+		}
+	}
+	offset := 0
+	if s := params.Get("offset"); s != "" {
+		offset, err = strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			writeError(w, validationFailed("offset must be a non-negative integer"))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Each kind fetches one extra result to tell whether more follow.
+	resp := searchResponse{Tweets: []models.TweetWithUser{}, Comments: []models.CommentWithUser{}, Users: []models.User{}}
+	more := false
+	if kind == "" || kind == "all" || kind == "tweets" {
+		if resp.Tweets, err = st.SearchTweets(ctx, q, limit+1, offset); err != nil {
+			writeError(w, err)
+			return
+		}
+		if len(resp.Tweets) > limit {
+			resp.Tweets, more = resp.Tweets[:limit], true
+		}
+	}
+	if kind == "" || kind == "all" || kind == "comments" {
+		if resp.Comments, err = st.SearchComments(ctx, q, limit+1, offset); err != nil {
+			writeError(w, err)
+			return
+		}
+		if len(resp.Comments) > limit {
+			resp.Comments, more = resp.Comments[:limit], true
+		}
+	}
+	if kind == "" || kind == "all" || kind == "users" {
+		if resp.Users, err = st.SearchUsers(ctx, q, limit+1, offset); err != nil {
+			writeError(w, err)
+			return
+		}
+		if len(resp.Users) > limit {
+			resp.Users, more = resp.Users[:limit], true
+		}
+	}
+	if more {
+		next := offset + limit
+		resp.NextOffset = &next
+	}
+
+	var deco decorator
+	deco.addTweets(resp.Tweets)
+	deco.addComments(resp.Comments)
+	if err := deco.fill(ctx, st); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+	log.Println("sent successfully")
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// maxSocketSubscriptions caps how many tweets and users one connection
+	// may follow at once.
+	maxSocketSubscriptions = 50
+	// socketBuffer is how many events and replies may wait to be written to
+	// a connection before it is closed as too slow.
+	socketBuffer = 64
+	// socketMaxMessage is the largest client message accepted, in bytes.
+	socketMaxMessage = 4096
+	// socketWriteWait bounds each write to a connection.
+	socketWriteWait = 10 * time.Second
+	// socketPongWait is how long a connection may go without a message or a
+	// pong before it is dropped.
+	socketPongWait = 60 * time.Second
+)
+
+// socketPingInterval is how often idle connections are pinged.
+var socketPingInterval = socketPongWait * 9 / 10
+
+var upgrader = websocket.Upgrader{
+	// Any origin may connect, as the CORS wrapper in app.go allows for every
+	// other route. Credentials are never sent implicitly: they come in the
+	// Authorization header or the access_token query parameter.
+	CheckOrigin: func(*http.Request) bool { return true },
+	// Failed handshakes, such as plain HTTP requests, get error envelopes too,
+	// and server errors the usual 500.
+	Error: func(w http.ResponseWriter, _ *http.Request, status int, reason error) {
+		if status >= http.StatusInternalServerError {
+			writeError(w, reason)
+			return
+		}
+		writeError(w, statusError(status, reason.Error()))
+	},
+}
+
+func init() {
+	route("GET /ws", socketHandler)
+}
+
+// Socket request actions and the reply types that are not event types.
+const (
+	socketSubscribe   = "subscribe"
+	socketUnsubscribe = "unsubscribe"
+	socketSubscribed  = "subscribed"
+	socketError       = "error"
+)
+
+// socketRequest is a message from a client adding or removing tweets and
+// users to follow.
+type socketRequest struct {
+	Action   string `json:"action"`
+	TweetIDs []int  `json:"tweet_ids"`
+	UserIDs  []int  `json:"user_ids"`
+}
+
+// socketMessage is a message to a client: an event with its id, type and
+// data as /events sends them, a "subscribed" reply listing what the
+// connection follows, or an "error" reply to a rejected request.
+type socketMessage struct {
+	Type  string          `json:"type"`
+	ID    int64           `json:"id,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// socketSubscriptionList is the data of a "subscribed" reply.
+type socketSubscriptionList struct {
+	TweetIDs []int `json:"tweet_ids"`
+	UserIDs  []int `json:"user_ids"`
+}
+
+// socketSubscriptions are the tweets and users a connection follows.
+type socketSubscriptions struct {
+	mu     sync.Mutex
+	tweets map[int]bool
+	users  map[int]bool
+}
+
+func newSocketSubscriptions() *socketSubscriptions {
+	return &socketSubscriptions{tweets: map[int]bool{}, users: map[int]bool{}}
+}
+
+// wants reports whether e concerns a followed tweet or was caused by a
+// followed user.
+func (s *socketSubscriptions) wants(e event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return (e.TweetID != 0 && s.tweets[e.TweetID]) || (e.UserID != 0 && s.users[e.UserID])
+}
+
+// apply carries out req and returns what the connection follows after it.
+// It changes nothing when req is invalid or would take the connection past
+// maxSocketSubscriptions.
+func (s *socketSubscriptions) apply(req socketRequest) (socketSubscriptionList, error) {
+	if req.Action != socketSubscribe && req.Action != socketUnsubscribe {
+		return socketSubscriptionList{}, fmt.Errorf("unknown action %q", req.Action)
+	}
+	for _, id := range slices.Concat(req.TweetIDs, req.UserIDs) {
+		if id <= 0 {
+			return socketSubscriptionList{}, errors.New("ids must be positive")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Action == socketSubscribe {
+		added := 0
+		for _, id := range req.TweetIDs {
+			if !s.tweets[id] {
+				added++
+			}
+		}
+		for _, id := range req.UserIDs {
+			if !s.users[id] {
+				added++
+			}
+		}
+		if len(s.tweets)+len(s.users)+added > maxSocketSubscriptions {
+			return socketSubscriptionList{}, fmt.Errorf("at most %d subscriptions per connection", maxSocketSubscriptions)
+		}
+	}
+	for _, id := range req.TweetIDs {
+		if req.Action == socketSubscribe {
+			s.tweets[id] = true
+		} else {
+			delete(s.tweets, id)
+		}
+	}
+	for _, id := range req.UserIDs {
+		if req.Action == socketSubscribe {
+			s.users[id] = true
+		} else {
+			delete(s.users, id)
+		}
+	}
+
+	list := socketSubscriptionList{TweetIDs: []int{}, UserIDs: []int{}}
+	for id := range s.tweets {
+		list.TweetIDs = append(list.TweetIDs, id)
+	}
+	for id := range s.users {
+		list.UserIDs = append(list.UserIDs, id)
+	}
+	slices.Sort(list.TweetIDs)
+	slices.Sort(list.UserIDs)
+	return list, nil
+}
+
+// socketHandler upgrades the request to a WebSocket on which the client
+// follows tweets and users. It sends
+//
+//	{"action": "subscribe", "tweet_ids": [1], "user_ids": [2]}
+//
+// or "unsubscribe" likewise, and is answered with the resulting
+// subscriptions. From then on it receives the events /events would send
+// that concern a followed tweet, such as its new comments and like counts,
+// or that a followed user caused. A connection that falls socketBuffer
+// messages behind is closed with code 1013 (try again later); the client
+// should reconnect and subscribe again.
+//
+// Browsers cannot set the Authorization header on a WebSocket, so the
+// session token or JWT may come in the access_token query parameter instead.
+// A signed-in connection also hears of the caller's own saves; an anonymous
+// one only of public events.
+func socketHandler(w http.ResponseWriter, r *http.Request, _ pathParams) {
+	log.Println("inilizied request")
+	viewerID, _ := UserIDFromContext(r.Context())
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		id, err := resolveToken(ctx, token)
+		cancel()
+		if err != nil {
+			log.Println("authentication failed:", err)
+			writeError(w, unauthorized("invalid access token"))
+			return
+		}
+		viewerID = id
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied with an error.
+		log.Println("websocket upgrade:", err)
+		return
+	}
+	defer conn.Close()
+
+	subs := newSocketSubscriptions()
+	sub, _ := liveEvents.subscribe(viewerID, subs.wants, socketBuffer, nil)
+	defer liveEvents.unsubscribe(sub)
+
+	replies := make(chan socketMessage, socketBuffer)
+	done := make(chan struct{})
+	go readSocket(conn, subs, replies, done)
+
+	ping := time.NewTicker(socketPingInterval)
+	defer ping.Stop()
+	for {
+		var msg socketMessage
+		select {
+		case <-done:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait)); err != nil {
+				return
+			}
+			continue
+		case msg = <-replies:
+		case e, ok := <-sub.events:
+			if !ok {
+				closeSocket(conn, websocket.CloseTryAgainLater, "too slow")
+				return
+			}
+			msg = socketMessage{Type: e.Type, ID: e.ID, Data: e.Data}
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+		if err := conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// readSocket handles the client's requests on conn, queueing the replies,
+// until the connection fails or the client stops reading its replies. It
+// closes done when it returns.
+func readSocket(conn *websocket.Conn, subs *socketSubscriptions, replies chan<- socketMessage, done chan<- struct{}) {
+	defer close(done)
+	conn.SetReadLimit(socketMaxMessage)
+	_ = conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(socketPongWait))
+
+		reply := socketMessage{Type: socketSubscribed}
+		var req socketRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			reply = socketMessage{Type: socketError, Error: "invalid message"}
+		} else if list, err := subs.apply(req); err != nil {
+			reply = socketMessage{Type: socketError, Error: err.Error()}
+		} else {
+			reply.Data, _ = json.Marshal(list)
+		}
+
+		select {
+		case replies <- reply:
+		default:
+			closeSocket(conn, websocket.CloseTryAgainLater, "too slow")
+			return
+		}
+	}
+}
+
+// closeSocket tells the client why conn is closing.
+func closeSocket(conn *websocket.Conn, code int, reason string) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(socketWriteWait))
+}
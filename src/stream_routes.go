@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// streamBuffer is how many events a stream may fall behind before it is
+	// closed for the client to reconnect and catch up.
+	streamBuffer = 64
+	// streamRetry is the reconnect delay suggested to clients, in
+	// milliseconds.
+	streamRetry = 3000
+)
+
+// heartbeatInterval is how often an idle stream sends a comment line so
+// proxies and clients keep it open.
+var heartbeatInterval = 15 * time.Second
+
+func init() {
+	route("GET /events", eventsHandler)
+}
+
+// eventsHandler streams live changes as Server-Sent Events: new tweets
+// ("tweet") and comments ("comment"), comment counters ("comment_count") and
+// likes, saves, restacks and follows ("interaction"). Saves only reach the
+// saver's own streams. A client reconnecting with the Last-Event-ID header,
+// or the last_event_id query parameter, first receives the events it missed;
+// when those are no longer kept it receives a "reset" event and should
+// reload instead.
+func eventsHandler(w http.ResponseWriter, r *http.Request, _ pathParams) {
+	log.Println("inilizied request")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, errors.New("streaming unsupported"))
+		return
+	}
+	var after *int64
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	if lastID != "" {
+		id, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil || id < 0 {
+			writeError(w, validationFailed("invalid last event id"))
+			return
+		}
+		after = &id
+	}
+	viewerID, _ := UserIDFromContext(r.Context())
+
+	sub, missed := liveEvents.subscribe(viewerID, nil, streamBuffer, after)
+	defer liveEvents.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+	for _, e := range missed {
+		writeEvent(w, e)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case e, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes e in the text/event-stream format.
+func writeEvent(w http.ResponseWriter, e event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+}
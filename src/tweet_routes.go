@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -10,60 +11,169 @@ import (
 	"time"
 
 	"github.com/et-hicks/imitation-backend/models"
-	postgrest "github.com/supabase-community/postgrest-go"
+	"github.com/et-hicks/imitation-backend/store"
+)
+
+const (
+	defaultThreadDepth = 3
+	maxThreadDepth     = 10
 )
 
 func init() {
-	http.HandleFunc("/tweet", createTweet)
-	http.HandleFunc("/tweet/", tweetHandler)
+	route("POST /tweet", createTweet)
+	route("GET /tweet/{tweet_id:int}", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		fetchTweet(w, r, p.Int("tweet_id"))
+	})
+	route("PATCH /tweet/{tweet_id:int}", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		editTweet(w, r, p.Int("tweet_id"))
+	})
+	route("DELETE /tweet/{tweet_id:int}", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		deleteTweet(w, r, p.Int("tweet_id"))
+	})
+	route("GET /tweet/{tweet_id:int}/comments", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		fetchComments(w, r, p.Int("tweet_id"))
+	})
+	route("GET /tweet/{tweet_id:int}/history", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		fetchHistory(w, r, p.Int("tweet_id"))
+	})
+	route("GET /tweet/{tweet_id:int}/likes", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		fetchInteractors(w, r, store.Target{ID: p.Int("tweet_id")}, store.Like)
+	})
+	route("GET /tweet/{tweet_id:int}/restacks", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		fetchInteractors(w, r, store.Target{ID: p.Int("tweet_id")}, store.Restack)
+	})
+	route("GET /comment/{comment_id:int}/replies", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		fetchThread(w, r, p.Int("comment_id"))
+	})
+	route("GET /comment/{comment_id:int}/likes", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		fetchInteractors(w, r, store.Target{ID: p.Int("comment_id"), IsComment: true}, store.Like)
+	})
+}
+
+// targetNoun names what a request about a tweet or comment is about, for
+// messages.
+func targetNoun(isComment bool) string {
+	if isComment {
+		return "comment"
+	}
+	return "tweet"
+}
+
+// authorOf returns the id of the user who wrote the tweet or comment, or
+// ErrNotFound.
+func authorOf(ctx context.Context, st store.Store, id int, isComment bool) (int, error) {
+	if isComment {
+		comment, err := st.CommentThread(ctx, id, 0)
+		return comment.UserID, err
+	}
+	tweet, err := st.GetTweet(ctx, id)
+	return tweet.UserID, err
+}
+
+// fetchThread returns a comment and its reply subtree.
+func fetchThread(w http.ResponseWriter, r *http.Request, commentID int) {
+	log.Println("inilizied request")
+	depth := defaultThreadDepth
+	if s := r.URL.Query().Get("depth"); s != "" {
+		var err error
+		depth, err = strconv.Atoi(s)
+		if err != nil || depth < 1 || depth > maxThreadDepth {
+			writeError(w, validationFailed("depth must be between 1 and "+strconv.Itoa(maxThreadDepth)))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	thread, err := st.CommentThread(ctx, commentID, depth)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, notFound("comment not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var deco decorator
+	deco.addThread(&thread)
+	if err := deco.fill(ctx, st); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(thread)
+	log.Println("sent successfully")
 }
 
-// tweetHandler handles retrieval of tweets and their comments.
-func tweetHandler(w http.ResponseWriter, r *http.Request) {
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 2 {
-		http.NotFound(w, r)
+// fetchInteractors returns a page of the users who liked or restacked a tweet
+// or comment, most recent first.
+func fetchInteractors(w http.ResponseWriter, r *http.Request, target store.Target, kind store.Interaction) {
+	log.Println("inilizied request")
+	page, ok := parsePage(w, r)
+	if !ok {
 		return
 	}
 
-	id := parts[1]
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
-	if len(parts) == 2 && r.Method == http.MethodGet {
-		fetchTweet(w, r, id)
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	if len(parts) == 3 && parts[2] == "comments" && r.Method == http.MethodGet {
-		fetchComments(w, r, id)
+	entries, err := st.Interactors(ctx, target, kind, page)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, notFound(targetNoun(target.IsComment)+" not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	http.NotFound(w, r)
+	writePage(w, page, entries, interactionCursor)
+	log.Println("sent successfully")
 }
 
 // fetchTweet returns a specific tweet with user info.
-func fetchTweet(w http.ResponseWriter, r *http.Request, tweetID string) {
+func fetchTweet(w http.ResponseWriter, r *http.Request, tweetID int) {
 	log.Println("inilizied request")
+
 	ctx := r.Context()
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	client, err := GetSupabase(ctx)
+	st, err := GetStore(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	qb := client.From("tweets").Select("*,users(*)", "", false)
-	qb = qb.Eq("id", tweetID)
-	data, _, err := qb.Single().Execute()
+	tweet, err := st.GetTweet(ctx, tweetID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, notFound("tweet not found"))
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
-	var tweet TweetWithUser
-	if err := json.Unmarshal(data, &tweet); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	var deco decorator
+	deco.addTweet(&tweet)
+	if err := deco.fill(ctx, st); err != nil {
+		writeError(w, err)
 		return
 	}
 
@@ -72,60 +182,220 @@ func fetchTweet(w http.ResponseWriter, r *http.Request, tweetID string) {
 	log.Println("sent successfully")
 }
 
-// fetchComments returns comments for a tweet.
-func fetchComments(w http.ResponseWriter, r *http.Request, tweetID string) {
+// fetchComments returns a page of the top-level comments for a tweet.
+func fetchComments(w http.ResponseWriter, r *http.Request, tweetID int) {
 	log.Println("inilizied request")
+	page, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
 	ctx := r.Context()
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	client, err := GetSupabase(ctx)
+	st, err := GetStore(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	var comments []CommentWithUser
-	qb := client.From("comments").Select("*,users(*)", "", false)
-	qb = qb.Eq("tweet_id", tweetID)
-	qb = qb.Order("created_at", &postgrest.OrderOpts{Ascending: false})
-	if _, err := qb.ExecuteTo(&comments); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	comments, err := st.TweetComments(ctx, tweetID, page)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var deco decorator
+	deco.addComments(comments)
+	if err := deco.fill(ctx, st); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, page, comments, commentCursor)
+	log.Println("sent successfully")
+}
+
+// editTweet replaces the body of a tweet or comment owned by the caller.
+func editTweet(w http.ResponseWriter, r *http.Request, id int) {
+	log.Println("inilizied request")
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var payload struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, validationFailed("invalid JSON body"))
+		return
+	}
+	var v validator
+	v.text("body", &payload.Body, true, maxBodyLength())
+	if err := v.err(); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Check the author before the mentions, so that the caller learns
+	// nothing about other users' names from tweets they cannot edit.
+	isComment := strings.ToLower(r.Header.Get("Is-Comment")) == "true"
+	authorID, err := authorOf(ctx, st, id, isComment)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, notFound(targetNoun(isComment)+" not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if authorID != userID {
+		writeError(w, forbidden("only the author can edit a "+targetNoun(isComment)))
+		return
+	}
+
+	if !checkMentions(w, ctx, st, payload.Body) {
+		return
+	}
+	entities, err := entitiesOf(ctx, st, payload.Body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var edited any
+	if isComment {
+		var comment models.Comment
+		comment, err = st.EditComment(ctx, userID, id, payload.Body)
+		edited = writtenComment{Comment: comment, Entities: entities}
+	} else {
+		var tweet models.Tweet
+		tweet, err = st.EditTweet(ctx, userID, id, payload.Body)
+		edited = writtenTweet{Tweet: tweet, Entities: entities}
+	}
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, notFound(targetNoun(isComment)+" not found"))
+		return
+	case errors.Is(err, store.ErrForbidden):
+		writeError(w, forbidden("only the author can edit a "+targetNoun(isComment)))
+		return
+	case err != nil:
+		writeError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(comments)
+	_ = json.NewEncoder(w).Encode(edited)
 	log.Println("sent successfully")
 }
 
-// createTweet inserts a new tweet for a user.
-func createTweet(w http.ResponseWriter, r *http.Request) {
+// deleteTweet deletes a tweet or comment owned by the caller along with
+// everything that depends on it.
+func deleteTweet(w http.ResponseWriter, r *http.Request, id int) {
 	log.Println("inilizied request")
-	if r.Method != http.MethodPost {
-		http.NotFound(w, r)
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	isComment := strings.ToLower(r.Header.Get("Is-Comment")) == "true"
+	if isComment {
+		err = st.DeleteComment(ctx, userID, id)
+	} else {
+		err = st.DeleteTweet(ctx, userID, id)
+	}
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, notFound(targetNoun(isComment)+" not found"))
+		return
+	case errors.Is(err, store.ErrForbidden):
+		writeError(w, forbidden("only the author can delete a "+targetNoun(isComment)))
+		return
+	case err != nil:
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Println("sent successfully")
+}
+
+// fetchHistory returns a page of the prior versions of a tweet or comment.
+func fetchHistory(w http.ResponseWriter, r *http.Request, id int) {
+	log.Println("inilizied request")
+	page, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
+	target := store.Target{ID: id, IsComment: strings.ToLower(r.Header.Get("Is-Comment")) == "true"}
+	revisions, err := st.History(ctx, target, page)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, notFound(targetNoun(target.IsComment)+" not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, page, revisions, revisionCursor)
+	log.Println("sent successfully")
+}
+
+// createTweet inserts a new tweet for a user.
+func createTweet(w http.ResponseWriter, r *http.Request, _ pathParams) {
+	log.Println("inilizied request")
+
 	var payload struct {
 		Body      string `json:"body"`
 		IsComment bool   `json:"is_comment"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, validationFailed("invalid JSON body"))
 		return
 	}
 
-	// Retrieve user auth information from headers
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		http.Error(w, "missing authorization", http.StatusUnauthorized)
+	userID, ok := requireUser(w, r)
+	if !ok {
 		return
 	}
-
-	userID, err := strconv.Atoi(authHeader)
-	if err != nil {
-		http.Error(w, "invalid authorization", http.StatusUnauthorized)
+	var v validator
+	v.text("body", &payload.Body, true, maxBodyLength())
+	if err := v.err(); err != nil {
+		writeError(w, err)
 		return
 	}
 
@@ -133,72 +403,101 @@ func createTweet(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	client, err := GetSupabase(ctx)
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if !checkMentions(w, ctx, st, payload.Body) {
+		return
+	}
+	entities, err := entitiesOf(ctx, st, payload.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	// When posting a comment, validate the user and require parent tweet ID
+	// When posting a comment, validate the user and require parent tweet ID,
+	// or a parent comment ID for a reply within a thread
 	if payload.IsComment {
+		// Validate that the user exists in the database
+		_, err = st.GetUser(ctx, userID)
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, unauthorized("unknown user"))
+			return
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if parentCommentIDStr := r.Header.Get("Parent-Comment-ID"); parentCommentIDStr != "" {
+			parentCommentID, err := strconv.Atoi(parentCommentIDStr)
+			if err != nil {
+				writeError(w, validationFailed("invalid parent comment id"))
+				return
+			}
+			reply, err := st.CreateReply(ctx, userID, parentCommentID, payload.Body)
+			if errors.Is(err, store.ErrNotFound) {
+				writeError(w, notFound("parent comment not found"))
+				return
+			}
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+
+			written := writtenComment{Comment: reply, Entities: entities}
+			publishComment(ctx, st, written, userID)
+
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(written)
+			log.Println("sent successfully")
+			return
+		}
+
 		// Ensure parent tweet id is provided in headers
 		parentIDStr := r.Header.Get("Parent-Tweet-ID")
 		if parentIDStr == "" {
-			http.Error(w, "missing parent tweet id", http.StatusBadRequest)
+			writeError(w, validationFailed("missing parent tweet id"))
 			return
 		}
 		parentID, err := strconv.Atoi(parentIDStr)
 		if err != nil {
-			http.Error(w, "invalid parent tweet id", http.StatusBadRequest)
+			writeError(w, validationFailed("invalid parent tweet id"))
 			return
 		}
 
-		// Validate that the user exists in the database
-		if _, _, err := client.From("users").Select("id", "", false).Eq("id", strconv.Itoa(userID)).Single().Execute(); err != nil {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		comment, err := st.CreateComment(ctx, userID, parentID, payload.Body)
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, notFound("parent tweet not found"))
 			return
 		}
-
-		qb := client.From("comments").Insert(map[string]interface{}{
-			"user_id":  userID,
-			"tweet_id": parentID,
-			"body":     payload.Body,
-		}, false, "", "", "")
-		data, _, err := qb.Single().Execute()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, err)
 			return
 		}
 
-		var comment models.Comment
-		if err := json.Unmarshal(data, &comment); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+		written := writtenComment{Comment: comment, Entities: entities}
+		publishComment(ctx, st, written, userID)
 
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(comment)
+		_ = json.NewEncoder(w).Encode(written)
 		log.Println("sent successfully")
 		return
 	}
 
-	qb := client.From("tweets").Insert(map[string]interface{}{
-		"user_id": userID,
-		"body":    payload.Body,
-	}, false, "", "", "")
-	data, _, err := qb.Single().Execute()
+	tweet, err := st.CreateTweet(ctx, userID, payload.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	var tweet models.Tweet
-	if err := json.Unmarshal(data, &tweet); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	written := writtenTweet{Tweet: tweet, Entities: entities}
+	publishEvent(eventTweet, written, tweet.ID, userID, 0)
 
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(tweet)
+	_ = json.NewEncoder(w).Encode(written)
 	log.Println("sent successfully")
 }
@@ -3,77 +3,252 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
-	postgrest "github.com/supabase-community/postgrest-go"
+	"github.com/et-hicks/imitation-backend/models"
+	"github.com/et-hicks/imitation-backend/store"
 )
 
 func init() {
-	http.HandleFunc("/user/", userHandler)
+	route("GET /user/{user_id:int}", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		userTweets(w, r, p.Int("user_id"))
+	})
+	route("POST /user/{user_id:int}/bio", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		updateBio(w, r, p.Int("user_id"))
+	})
+	route("GET /user/{user_id:int}/followers", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		followList(w, r, p.Int("user_id"), "followers")
+	})
+	route("GET /user/{user_id:int}/following", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		followList(w, r, p.Int("user_id"), "following")
+	})
+	route("GET /user/{user_id:int}/likes", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		likedItems(w, r, p.Int("user_id"))
+	})
+	route("GET /user/{user_id:int}/mentions", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		mentionItems(w, r, p.Int("user_id"))
+	})
+	route("GET /user/{user_id:int}/saved", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		savedTweets(w, r, p.Int("user_id"))
+	})
+	route("GET /user/{user_id:int}/folders", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		listFolders(w, r, p.Int("user_id"))
+	})
+	route("POST /user/{user_id:int}/folders", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		createFolder(w, r, p.Int("user_id"))
+	})
+	route("DELETE /user/{user_id:int}/folders/{folder_id:int}", func(w http.ResponseWriter, r *http.Request, p pathParams) {
+		deleteFolder(w, r, p.Int("user_id"), p.Int("folder_id"))
+	})
 }
 
-// userHandler dispatches user related routes.
-func userHandler(w http.ResponseWriter, r *http.Request) {
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 2 {
-		http.NotFound(w, r)
+// userTweets returns the specified user's profile, with follower and
+// following counts, and a page of their feed: their tweets and restacks.
+func userTweets(w http.ResponseWriter, r *http.Request, userID int) {
+	log.Println("inilizied request")
+	page, ok := parsePage(w, r)
+	if !ok {
 		return
 	}
 
-	id := parts[1]
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
-	if len(parts) == 2 && r.Method == http.MethodGet {
-		userTweets(w, r, id)
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	if len(parts) == 3 && parts[2] == "bio" && r.Method == http.MethodPost {
-		updateBio(w, r, id)
+	profile, err := st.GetProfile(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, notFound("user not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	http.NotFound(w, r)
+	items, err := st.UserFeed(ctx, userID, page)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var deco decorator
+	deco.addFeed(items)
+	if err := deco.fill(ctx, st); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp := struct {
+		User models.Profile `json:"user"`
+		pageResponse[models.FeedItem]
+	}{profile, newPageResponse(page, items, feedCursor)}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+	log.Println("sent successfully")
 }
 
-// userTweets returns 10 latest tweets for the specified user.
-func userTweets(w http.ResponseWriter, r *http.Request, userID string) {
+// followList returns a page of the users following the specified user, or
+// that the user follows, depending on which.
+func followList(w http.ResponseWriter, r *http.Request, userID int, which string) {
 	log.Println("inilizied request")
+	page, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
 	ctx := r.Context()
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	client, err := GetSupabase(ctx)
+	st, err := GetStore(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	var tweets []TweetWithUser
-	qb := client.From("tweets").Select("*,users(*)", "", false)
-	qb = qb.Eq("user_id", userID)
-	qb = qb.Order("created_at", &postgrest.OrderOpts{Ascending: false})
-	qb = qb.Limit(10, "")
-	if _, err := qb.ExecuteTo(&tweets); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	_, err = st.GetUser(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, notFound("user not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(tweets)
+	list := st.Followers
+	if which == "following" {
+		list = st.Following
+	}
+	entries, err := list(ctx, userID, page)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, page, entries, followCursor)
+	log.Println("sent successfully")
+}
+
+// likedItems returns a page of the tweets and comments the specified user
+// liked, most recently liked first.
+func likedItems(w http.ResponseWriter, r *http.Request, userID int) {
+	log.Println("inilizied request")
+	page, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	_, err = st.GetUser(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, notFound("user not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	items, err := st.LikedItems(ctx, userID, page)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var deco decorator
+	deco.addLiked(items)
+	if err := deco.fill(ctx, st); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, page, items, likedCursor)
+	log.Println("sent successfully")
+}
+
+// mentionItems returns a page of the tweets and comments that mention the
+// specified user, most recently mentioned first.
+func mentionItems(w http.ResponseWriter, r *http.Request, userID int) {
+	log.Println("inilizied request")
+	page, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	st, err := GetStore(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	_, err = st.GetUser(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, notFound("user not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	items, err := st.Mentions(ctx, userID, page)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var deco decorator
+	deco.addMentions(items)
+	if err := deco.fill(ctx, st); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, page, items, mentionCursor)
 	log.Println("sent successfully")
 }
 
 // updateBio updates the bio for a given user.
-func updateBio(w http.ResponseWriter, r *http.Request, userID string) {
+func updateBio(w http.ResponseWriter, r *http.Request, pathUserID int) {
 	log.Println("inilizied request")
+	userID, ok := requireSelf(w, r, pathUserID)
+	if !ok {
+		return
+	}
+
 	var payload struct {
 		Bio string `json:"bio"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, validationFailed("invalid JSON body"))
+		return
+	}
+	payload.Bio = strings.TrimSpace(payload.Bio)
+	var v validator
+	v.text("bio", &payload.Bio, false, maxBioLength())
+	if err := v.err(); err != nil {
+		writeError(w, err)
 		return
 	}
 
@@ -81,16 +256,19 @@ func updateBio(w http.ResponseWriter, r *http.Request, userID string) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	client, err := GetSupabase(ctx)
+	st, err := GetStore(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	qb := client.From("users").Update(map[string]string{"bio": payload.Bio}, "", "")
-	qb = qb.Eq("id", userID)
-	if _, _, err := qb.Execute(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	err = st.UpdateBio(ctx, userID, payload.Bio)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, notFound("user not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Default text limits, in user-perceived characters. The MAX_BODY_LENGTH
+// and MAX_BIO_LENGTH environment variables override them.
+const (
+	defaultMaxBodyLength = 280
+	defaultMaxBioLength  = 160
+)
+
+// Field error codes, naming the rule a field broke.
+const (
+	fieldRequired = "required"
+	fieldTooLong  = "too_long"
+)
+
+// fieldError says why one field of a request was rejected.
+type fieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// maxBodyLength is the longest tweet or comment body accepted.
+func maxBodyLength() int {
+	return limitFromEnv("MAX_BODY_LENGTH", defaultMaxBodyLength)
+}
+
+// maxBioLength is the longest bio accepted.
+func maxBioLength() int {
+	return limitFromEnv("MAX_BIO_LENGTH", defaultMaxBioLength)
+}
+
+// limitFromEnv returns the positive integer in the environment variable
+// name, or def when it is unset or not one.
+func limitFromEnv(name string, def int) int {
+	s := os.Getenv(name)
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		log.Printf("%s=%q is not a positive integer; using %d", name, s, def)
+		return def
+	}
+	return n
+}
+
+// validator collects the field errors of one request.
+type validator struct {
+	fields []fieldError
+}
+
+// text normalizes *s to NFC and checks it is at most max characters long,
+// counting grapheme clusters so that an emoji or an accented letter is one
+// character however it is encoded. A required text must also have something
+// besides whitespace and invisible formatting characters.
+func (v *validator) text(field string, s *string, required bool, max int) {
+	*s = norm.NFC.String(*s)
+	switch {
+	case required && isBlank(*s):
+		v.fields = append(v.fields, fieldError{Field: field, Code: fieldRequired, Message: field + " must not be blank"})
+	case uniseg.GraphemeClusterCount(*s) > max:
+		v.fields = append(v.fields, fieldError{
+			Field:   field,
+			Code:    fieldTooLong,
+			Message: field + " must be at most " + strconv.Itoa(max) + " characters",
+		})
+	}
+}
+
+// err returns the collected field errors as a validation_failed error, or
+// nil when there are none.
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	e := validationFailed(v.fields[0].Message)
+	e.Fields = v.fields
+	return e
+}
+
+// isBlank reports whether s has nothing but whitespace and format
+// characters such as zero-width spaces.
+func isBlank(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsSpace(r) && !unicode.Is(unicode.Cf, r)
+	}) < 0
+}
@@ -0,0 +1,31 @@
+package store
+
+import "github.com/et-hicks/imitation-backend/models"
+
+// assembleLikes pairs like rows, in listing order, with the tweets and
+// comments they name. Rows whose target is missing are dropped.
+func assembleLikes(rows []models.UserTweetInteraction, tweets map[int]models.TweetWithUser, comments map[int]models.CommentWithUser) []models.LikedItem {
+	items := make([]models.LikedItem, 0, len(rows))
+	for _, row := range rows {
+		target, ok := interactionTarget(row)
+		if !ok || row.LikedAt == nil {
+			continue
+		}
+		item := models.LikedItem{ID: row.ID, Kind: models.LikedTweet, LikedAt: *row.LikedAt}
+		if target.IsComment {
+			c, ok := comments[target.ID]
+			if !ok {
+				continue
+			}
+			item.Kind, item.Comment = models.LikedComment, &c
+		} else {
+			t, ok := tweets[target.ID]
+			if !ok {
+				continue
+			}
+			item.Tweet = &t
+		}
+		items = append(items, item)
+	}
+	return items
+}
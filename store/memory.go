@@ -0,0 +1,1644 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/et-hicks/imitation-backend/models"
+)
+
+// Memory is a Store that keeps all data in process memory. It is meant for
+// local development and tests and can be seeded from the SQL fixtures in sql/.
+type Memory struct {
+	mu sync.RWMutex
+
+	users         map[int]models.User
+	tweets        map[int]models.Tweet
+	comments      map[int]models.Comment
+	interactions  []models.UserTweetInteraction
+	revisions     []models.Revision
+	mentions      []models.Mention
+	notifications []memoryNotification
+	folders       map[int]models.BookmarkFolder
+	follows       []follow
+	sessions      map[string]memorySession
+	authUsers     map[string]int
+
+	nextUserID         int
+	nextTweetID        int
+	nextCommentID      int
+	nextInteractionID  int
+	nextRevisionID     int
+	nextFolderID       int
+	nextMentionID      int
+	nextNotificationID int
+}
+
+type follow struct {
+	UserID          int
+	FollowingUserID int
+	CreatedAt       time.Time
+}
+
+// memoryNotification is a notification with every actor in it.
+type memoryNotification struct {
+	notificationRow
+	actors []notificationActor
+}
+
+type notificationActor struct {
+	ActorID   int
+	CreatedAt time.Time
+}
+
+type memorySession struct {
+	AuthUserID string
+	Expires    time.Time
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		users:              map[int]models.User{},
+		tweets:             map[int]models.Tweet{},
+		comments:           map[int]models.Comment{},
+		folders:            map[int]models.BookmarkFolder{},
+		sessions:           map[string]memorySession{},
+		authUsers:          map[string]int{},
+		nextUserID:         1,
+		nextTweetID:        1,
+		nextCommentID:      1,
+		nextInteractionID:  1,
+		nextRevisionID:     1,
+		nextFolderID:       1,
+		nextMentionID:      1,
+		nextNotificationID: 1,
+	}
+}
+
+// SeedFiles loads the INSERT statements of each SQL fixture file in order.
+func (m *Memory) SeedFiles(paths ...string) error {
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := m.SeedSQL(string(src)); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// SeedSQL loads the INSERT statements in src. Supported tables are users,
+// tweets, comments, bookmark_folders, user_tweet_interactions, user_following,
+// user_auth_map and next_auth.sessions.
+func (m *Memory) SeedSQL(src string) error {
+	inserts, err := parseSeedSQL(src)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ins := range inserts {
+		for _, row := range ins.Rows {
+			if err := m.seedRow(ins.Table, row); err != nil {
+				return fmt.Errorf("%s: %w", ins.Table, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) seedRow(table string, row seedRow) error {
+	var err error
+	set := func(dst any, v any) {
+		if err != nil {
+			return
+		}
+		switch d := dst.(type) {
+		case *int:
+			*d, err = seedInt(v)
+		case *string:
+			*d, err = seedString(v)
+		case *bool:
+			*d, err = seedBool(v)
+		case *time.Time:
+			*d, err = seedTime(v)
+		case **int:
+			var n int
+			if n, err = seedInt(v); v != nil {
+				*d = &n
+			}
+		case **time.Time:
+			var t time.Time
+			if t, err = seedTime(v); v != nil {
+				*d = &t
+			}
+		}
+	}
+	now := time.Now().UTC()
+
+	switch table {
+	case "users":
+		u := models.User{ID: m.nextUserID, CreatedAt: now}
+		for col, v := range row {
+			switch col {
+			case "id":
+				set(&u.ID, v)
+			case "created_at":
+				set(&u.CreatedAt, v)
+			case "username":
+				set(&u.Username, v)
+			case "profile_name":
+				set(&u.ProfileName, v)
+			case "profile_url":
+				set(&u.ProfileURL, v)
+			case "bio":
+				set(&u.Bio, v)
+			default:
+				return fmt.Errorf("unknown column %q", col)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		m.users[u.ID] = u
+		m.nextUserID = max(m.nextUserID, u.ID+1)
+
+	case "tweets":
+		t := models.Tweet{ID: m.nextTweetID, CreatedAt: now}
+		for col, v := range row {
+			switch col {
+			case "id":
+				set(&t.ID, v)
+			case "user_id":
+				set(&t.UserID, v)
+			case "body":
+				set(&t.Body, v)
+			case "likes":
+				set(&t.Likes, v)
+			case "saves":
+				set(&t.Saves, v)
+			case "restacks":
+				set(&t.Restacks, v)
+			case "replies":
+				set(&t.Replies, v)
+			case "comments":
+				set(&t.Comments, v)
+			case "is_edited":
+				set(&t.IsEdited, v)
+			case "created_at":
+				set(&t.CreatedAt, v)
+			case "last_edited_at":
+				set(&t.LastEditedAt, v)
+			default:
+				return fmt.Errorf("unknown column %q", col)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		m.tweets[t.ID] = t
+		m.nextTweetID = max(m.nextTweetID, t.ID+1)
+		m.indexMentions(Target{ID: t.ID}, t.Body, t.CreatedAt)
+
+	case "comments":
+		c := models.Comment{ID: m.nextCommentID, CreatedAt: now}
+		for col, v := range row {
+			switch col {
+			case "id":
+				set(&c.ID, v)
+			case "user_id":
+				set(&c.UserID, v)
+			case "tweet_id":
+				set(&c.TweetID, v)
+			case "parent_comment_id":
+				set(&c.ParentCommentID, v)
+			case "body":
+				set(&c.Body, v)
+			case "likes":
+				set(&c.Likes, v)
+			case "replies":
+				set(&c.Replies, v)
+			case "is_edited":
+				set(&c.IsEdited, v)
+			case "created_at":
+				set(&c.CreatedAt, v)
+			case "last_edited_at":
+				set(&c.LastEditedAt, v)
+			default:
+				return fmt.Errorf("unknown column %q", col)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		m.comments[c.ID] = c
+		m.nextCommentID = max(m.nextCommentID, c.ID+1)
+		m.indexMentions(Target{ID: c.ID, IsComment: true}, c.Body, c.CreatedAt)
+
+	case "user_tweet_interactions":
+		i := models.UserTweetInteraction{ID: m.nextInteractionID, CreatedAt: now}
+		for col, v := range row {
+			switch col {
+			case "id":
+				set(&i.ID, v)
+			case "user_id":
+				set(&i.UserID, v)
+			case "tweet_id":
+				set(&i.TweetID, v)
+			case "comment_id":
+				set(&i.CommentID, v)
+			case "is_saved":
+				set(&i.IsSaved, v)
+			case "is_liked":
+				set(&i.IsLiked, v)
+			case "is_restacked":
+				set(&i.IsRestacked, v)
+			case "liked_at":
+				set(&i.LikedAt, v)
+			case "restacked_at":
+				set(&i.RestackedAt, v)
+			case "saved_at":
+				set(&i.SavedAt, v)
+			case "folder_id":
+				set(&i.FolderID, v)
+			case "created_at":
+				set(&i.CreatedAt, v)
+			default:
+				return fmt.Errorf("unknown column %q", col)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if i.IsRestacked && i.RestackedAt == nil {
+			restackedAt := i.CreatedAt
+			i.RestackedAt = &restackedAt
+		}
+		if i.IsLiked && i.LikedAt == nil {
+			likedAt := i.CreatedAt
+			i.LikedAt = &likedAt
+		}
+		if i.IsSaved && i.SavedAt == nil {
+			savedAt := i.CreatedAt
+			i.SavedAt = &savedAt
+		}
+		m.interactions = append(m.interactions, i)
+		m.nextInteractionID = max(m.nextInteractionID, i.ID+1)
+
+	case "bookmark_folders":
+		f := models.BookmarkFolder{ID: m.nextFolderID, CreatedAt: now}
+		for col, v := range row {
+			switch col {
+			case "id":
+				set(&f.ID, v)
+			case "user_id":
+				set(&f.UserID, v)
+			case "name":
+				set(&f.Name, v)
+			case "created_at":
+				set(&f.CreatedAt, v)
+			default:
+				return fmt.Errorf("unknown column %q", col)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		m.folders[f.ID] = f
+		m.nextFolderID = max(m.nextFolderID, f.ID+1)
+
+	case "user_following":
+		f := follow{CreatedAt: now}
+		for col, v := range row {
+			switch col {
+			case "user_id":
+				set(&f.UserID, v)
+			case "following_user_id":
+				set(&f.FollowingUserID, v)
+			case "created_at":
+				set(&f.CreatedAt, v)
+			default:
+				return fmt.Errorf("unknown column %q", col)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		m.follows = append(m.follows, f)
+
+	case "user_auth_map":
+		var authUserID string
+		var userID int
+		for col, v := range row {
+			switch col {
+			case "auth_user_id":
+				set(&authUserID, v)
+			case "user_id":
+				set(&userID, v)
+			default:
+				return fmt.Errorf("unknown column %q", col)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		m.authUsers[authUserID] = userID
+
+	case "next_auth.sessions":
+		var token string
+		var s memorySession
+		for col, v := range row {
+			switch col {
+			case "sessionToken":
+				set(&token, v)
+			case "userId":
+				set(&s.AuthUserID, v)
+			case "expires":
+				set(&s.Expires, v)
+			case "id":
+			default:
+				return fmt.Errorf("unknown column %q", col)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		m.sessions[token] = s
+
+	default:
+		return fmt.Errorf("unsupported table")
+	}
+	return nil
+}
+
+// tweetWithUser joins a tweet to its author. Callers hold m.mu.
+func (m *Memory) tweetWithUser(t models.Tweet) models.TweetWithUser {
+	return models.TweetWithUser{Tweet: t, User: m.users[t.UserID]}
+}
+
+// commentWithUser joins a comment to its author. Callers hold m.mu.
+func (m *Memory) commentWithUser(c models.Comment) models.CommentWithUser {
+	return models.CommentWithUser{Comment: c, User: m.users[c.UserID]}
+}
+
+// before reports whether a row at (createdAt, id) sorts after cursor in a
+// newest-first listing.
+func (c *Cursor) before(createdAt time.Time, id int) bool {
+	if c == nil {
+		return true
+	}
+	if createdAt.Equal(c.CreatedAt) {
+		return id < c.ID
+	}
+	return createdAt.Before(c.CreatedAt)
+}
+
+// beforeFeed is before for feed entries, which break ties on the
+// restacking user's id, 0 for a post.
+func (c *Cursor) beforeFeed(at time.Time, id, restackedBy int) bool {
+	if c == nil {
+		return true
+	}
+	if at.Equal(c.CreatedAt) && id == c.ID {
+		return restackedBy < c.RestackedBy
+	}
+	return c.before(at, id)
+}
+
+// newestFirst orders (created_at, id) keys descending.
+func newestFirst(aCreated time.Time, aID int, bCreated time.Time, bID int) bool {
+	if !aCreated.Equal(bCreated) {
+		return aCreated.After(bCreated)
+	}
+	return aID > bID
+}
+
+// newestTweets returns a page of tweets matching keep, newest first.
+// Callers hold m.mu.
+func (m *Memory) newestTweets(page Page, keep func(models.Tweet) bool) []models.TweetWithUser {
+	tweets := make([]models.Tweet, 0, len(m.tweets))
+	for _, t := range m.tweets {
+		if keep(t) && page.Before.before(t.CreatedAt, t.ID) {
+			tweets = append(tweets, t)
+		}
+	}
+	sort.Slice(tweets, func(i, j int) bool {
+		return newestFirst(tweets[i].CreatedAt, tweets[i].ID, tweets[j].CreatedAt, tweets[j].ID)
+	})
+	if len(tweets) > page.Limit {
+		tweets = tweets[:page.Limit]
+	}
+	out := make([]models.TweetWithUser, 0, len(tweets))
+	for _, t := range tweets {
+		out = append(out, m.tweetWithUser(t))
+	}
+	return out
+}
+
+func (m *Memory) LatestTweets(ctx context.Context, page Page) ([]models.TweetWithUser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.newestTweets(page, func(models.Tweet) bool { return true }), nil
+}
+
+func (m *Memory) UserFeed(ctx context.Context, userID int, page Page) ([]models.FeedItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.feed(map[int]bool{userID: true}, page), nil
+}
+
+func (m *Memory) HashtagTweets(ctx context.Context, tag string, page Page) ([]models.TweetWithUser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.newestTweets(page, func(t models.Tweet) bool {
+		return slices.ContainsFunc(models.ExtractEntities(t.Body).Hashtags, func(h models.HashtagEntity) bool {
+			return h.Tag == tag
+		})
+	}), nil
+}
+
+func (m *Memory) GetTweet(ctx context.Context, tweetID int) (models.TweetWithUser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.tweets[tweetID]
+	if !ok {
+		return models.TweetWithUser{}, ErrNotFound
+	}
+	return m.tweetWithUser(t), nil
+}
+
+func (m *Memory) CreateTweet(ctx context.Context, userID int, body string) (models.Tweet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[userID]; !ok {
+		return models.Tweet{}, fmt.Errorf("user %d: %w", userID, ErrNotFound)
+	}
+	t := models.Tweet{
+		ID:        m.nextTweetID,
+		UserID:    userID,
+		Body:      body,
+		CreatedAt: time.Now().UTC(),
+	}
+	m.nextTweetID++
+	m.tweets[t.ID] = t
+	m.indexMentions(Target{ID: t.ID}, body, t.CreatedAt)
+	return t, nil
+}
+
+func (m *Memory) FollowingTimeline(ctx context.Context, viewerID int, page Page) ([]models.FeedItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sources := map[int]bool{viewerID: true}
+	for _, f := range m.follows {
+		if f.UserID == viewerID {
+			sources[f.FollowingUserID] = true
+		}
+	}
+	return m.feed(sources, page), nil
+}
+
+// feed returns a page of the tweets written or restacked by sources, one
+// entry for each post and each restack. Callers hold m.mu.
+func (m *Memory) feed(sources map[int]bool, page Page) []models.FeedItem {
+	var items []models.FeedItem
+	add := func(t models.Tweet, at time.Time, restackedBy int) {
+		if !page.Before.beforeFeed(at, t.ID, restackedBy) {
+			return
+		}
+		item := models.FeedItem{TweetWithUser: m.tweetWithUser(t), Kind: models.FeedTweet, FeedAt: at}
+		if restackedBy != 0 {
+			u := m.users[restackedBy]
+			item.Kind, item.RestackedBy = models.FeedRestack, &u
+		}
+		items = append(items, item)
+	}
+	for _, t := range m.tweets {
+		if sources[t.UserID] {
+			add(t, t.CreatedAt, 0)
+		}
+	}
+	for _, row := range m.interactions {
+		if !row.IsRestacked || row.CommentID != nil || row.TweetID == nil || !sources[row.UserID] {
+			continue
+		}
+		t, ok := m.tweets[*row.TweetID]
+		if !ok {
+			continue
+		}
+		at := row.CreatedAt
+		if row.RestackedAt != nil {
+			at = *row.RestackedAt
+		}
+		add(t, at, row.UserID)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if !a.FeedAt.Equal(b.FeedAt) || a.ID != b.ID {
+			return newestFirst(a.FeedAt, a.ID, b.FeedAt, b.ID)
+		}
+		return restackerID(a) > restackerID(b)
+	})
+	if len(items) > page.Limit {
+		items = items[:page.Limit]
+	}
+	return items
+}
+
+// restackerID is the id of the user who restacked a feed entry, or 0 for a
+// post.
+func restackerID(item models.FeedItem) int {
+	if item.RestackedBy == nil {
+		return 0
+	}
+	return item.RestackedBy.ID
+}
+
+func (m *Memory) DeleteTweet(ctx context.Context, userID, tweetID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tweets[tweetID]
+	if !ok {
+		return ErrNotFound
+	}
+	if t.UserID != userID {
+		return ErrForbidden
+	}
+	for id, c := range m.comments {
+		if c.TweetID == tweetID {
+			m.deleteComment(id)
+		}
+	}
+	m.interactions = slices.DeleteFunc(m.interactions, func(row models.UserTweetInteraction) bool {
+		return row.CommentID == nil && row.TweetID != nil && *row.TweetID == tweetID
+	})
+	m.revisions = slices.DeleteFunc(m.revisions, func(r models.Revision) bool {
+		return r.TweetID != nil && *r.TweetID == tweetID
+	})
+	m.mentions = slices.DeleteFunc(m.mentions, func(row models.Mention) bool {
+		return row.TweetID != nil && *row.TweetID == tweetID
+	})
+	m.notifications = slices.DeleteFunc(m.notifications, func(n memoryNotification) bool {
+		return n.CommentID == nil && n.TweetID != nil && *n.TweetID == tweetID
+	})
+	delete(m.tweets, tweetID)
+	return nil
+}
+
+func (m *Memory) TweetComments(ctx context.Context, tweetID int, page Page) ([]models.CommentWithUser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	comments := make([]models.Comment, 0)
+	for _, c := range m.comments {
+		if c.TweetID == tweetID && c.ParentCommentID == nil && page.Before.before(c.CreatedAt, c.ID) {
+			comments = append(comments, c)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		return newestFirst(comments[i].CreatedAt, comments[i].ID, comments[j].CreatedAt, comments[j].ID)
+	})
+	if len(comments) > page.Limit {
+		comments = comments[:page.Limit]
+	}
+	out := make([]models.CommentWithUser, 0, len(comments))
+	for _, c := range comments {
+		out = append(out, m.commentWithUser(c))
+	}
+	return out, nil
+}
+
+func (m *Memory) CreateComment(ctx context.Context, userID, tweetID int, body string) (models.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tweets[tweetID]; !ok {
+		return models.Comment{}, fmt.Errorf("tweet %d: %w", tweetID, ErrNotFound)
+	}
+	return m.insertComment(userID, tweetID, nil, body)
+}
+
+func (m *Memory) CreateReply(ctx context.Context, userID, parentCommentID int, body string) (models.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parent, ok := m.comments[parentCommentID]
+	if !ok {
+		return models.Comment{}, fmt.Errorf("comment %d: %w", parentCommentID, ErrNotFound)
+	}
+	return m.insertComment(userID, parent.TweetID, &parent.ID, body)
+}
+
+// insertComment stores a comment and bumps the counters that
+// sql/counters.sql maintains. Callers hold m.mu and check tweetID.
+func (m *Memory) insertComment(userID, tweetID int, parentID *int, body string) (models.Comment, error) {
+	if _, ok := m.users[userID]; !ok {
+		return models.Comment{}, fmt.Errorf("user %d: %w", userID, ErrNotFound)
+	}
+	c := models.Comment{
+		ID:              m.nextCommentID,
+		UserID:          userID,
+		TweetID:         tweetID,
+		ParentCommentID: parentID,
+		Body:            body,
+		CreatedAt:       time.Now().UTC(),
+	}
+	m.nextCommentID++
+	m.comments[c.ID] = c
+	m.applyCommentDelta(c, 1)
+	m.indexMentions(Target{ID: c.ID, IsComment: true}, body, c.CreatedAt)
+	parent := Target{ID: tweetID}
+	if parentID != nil {
+		parent = Target{ID: *parentID, IsComment: true}
+	}
+	if author, ok := m.author(parent); ok {
+		m.notify(author, userID, models.NotifyReply, &parent)
+	}
+	return c, nil
+}
+
+// applyCommentDelta adjusts the counters of the tweet and parent comment of
+// c when it is added or removed. Callers hold m.mu.
+func (m *Memory) applyCommentDelta(c models.Comment, delta int) {
+	if t, ok := m.tweets[c.TweetID]; ok {
+		t.Comments += delta
+		if c.ParentCommentID == nil {
+			t.Replies += delta
+		}
+		m.tweets[t.ID] = t
+	}
+	if c.ParentCommentID != nil {
+		if parent, ok := m.comments[*c.ParentCommentID]; ok {
+			parent.Replies += delta
+			m.comments[parent.ID] = parent
+		}
+	}
+}
+
+func (m *Memory) CommentThread(ctx context.Context, commentID, depth int) (models.CommentThread, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	root, ok := m.comments[commentID]
+	if !ok {
+		return models.CommentThread{}, ErrNotFound
+	}
+	var rows []models.CommentWithUser
+	for _, c := range m.comments {
+		if c.TweetID == root.TweetID {
+			rows = append(rows, m.commentWithUser(c))
+		}
+	}
+	return assembleThread(m.commentWithUser(root), rows, depth), nil
+}
+
+// recordRevision keeps body as a prior version of target, stamped now.
+// Callers hold m.mu.
+func (m *Memory) recordRevision(target Target, body string, now time.Time) {
+	id := target.ID
+	r := models.Revision{ID: m.nextRevisionID, Body: body, CreatedAt: now}
+	if target.IsComment {
+		r.CommentID = &id
+	} else {
+		r.TweetID = &id
+	}
+	m.nextRevisionID++
+	m.revisions = append(m.revisions, r)
+}
+
+// indexMentions brings the mentions of target in line with body as
+// sql/mentions.sql does: mentions body dropped are removed and new ones are
+// stamped now. Callers hold m.mu.
+func (m *Memory) indexMentions(target Target, body string, now time.Time) {
+	mentioned := map[int]bool{}
+	for _, name := range models.MentionedUsernames(body) {
+		for _, u := range m.users {
+			if strings.ToLower(u.Username) == name {
+				mentioned[u.ID] = true
+			}
+		}
+	}
+	names := func(row models.Mention) bool {
+		if target.IsComment {
+			return row.CommentID != nil && *row.CommentID == target.ID
+		}
+		return row.TweetID != nil && *row.TweetID == target.ID
+	}
+	author, _ := m.author(target)
+	m.mentions = slices.DeleteFunc(m.mentions, func(row models.Mention) bool {
+		if !names(row) {
+			return false
+		}
+		if mentioned[row.UserID] {
+			delete(mentioned, row.UserID)
+			return false
+		}
+		m.unnotify(row.UserID, author, models.NotifyMention, &target)
+		return true
+	})
+	for userID := range mentioned {
+		m.notify(userID, author, models.NotifyMention, &target)
+		id := target.ID
+		row := models.Mention{ID: m.nextMentionID, UserID: userID, CreatedAt: now}
+		if target.IsComment {
+			row.CommentID = &id
+		} else {
+			row.TweetID = &id
+		}
+		m.nextMentionID++
+		m.mentions = append(m.mentions, row)
+	}
+}
+
+func (m *Memory) EditTweet(ctx context.Context, editorID, tweetID int, body string) (models.Tweet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tweets[tweetID]
+	if !ok {
+		return models.Tweet{}, ErrNotFound
+	}
+	if t.UserID != editorID {
+		return models.Tweet{}, ErrForbidden
+	}
+	if t.Body != body {
+		now := time.Now().UTC()
+		m.recordRevision(Target{ID: tweetID}, t.Body, now)
+		t.Body, t.IsEdited, t.LastEditedAt = body, true, now
+		m.tweets[tweetID] = t
+		m.indexMentions(Target{ID: tweetID}, body, now)
+	}
+	return t, nil
+}
+
+func (m *Memory) EditComment(ctx context.Context, editorID, commentID int, body string) (models.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.comments[commentID]
+	if !ok {
+		return models.Comment{}, ErrNotFound
+	}
+	if c.UserID != editorID {
+		return models.Comment{}, ErrForbidden
+	}
+	if c.Body != body {
+		now := time.Now().UTC()
+		m.recordRevision(Target{ID: commentID, IsComment: true}, c.Body, now)
+		c.Body, c.IsEdited, c.LastEditedAt = body, true, now
+		m.comments[commentID] = c
+		m.indexMentions(Target{ID: commentID, IsComment: true}, body, now)
+	}
+	return c, nil
+}
+
+func (m *Memory) History(ctx context.Context, target Target, page Page) ([]models.Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.tweets[target.ID]; !ok && !target.IsComment {
+		return nil, ErrNotFound
+	}
+	if _, ok := m.comments[target.ID]; !ok && target.IsComment {
+		return nil, ErrNotFound
+	}
+	out := make([]models.Revision, 0)
+	for _, r := range m.revisions {
+		id := r.TweetID
+		if target.IsComment {
+			id = r.CommentID
+		}
+		if id != nil && *id == target.ID && page.Before.before(r.CreatedAt, r.ID) {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return newestFirst(out[i].CreatedAt, out[i].ID, out[j].CreatedAt, out[j].ID)
+	})
+	if len(out) > page.Limit {
+		out = out[:page.Limit]
+	}
+	return out, nil
+}
+
+func (m *Memory) DeleteComment(ctx context.Context, userID, commentID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.comments[commentID]
+	if !ok {
+		return ErrNotFound
+	}
+	if c.UserID != userID {
+		return ErrForbidden
+	}
+	m.deleteComment(commentID)
+	return nil
+}
+
+// deleteComment removes a comment with its replies, interactions and edit
+// history, adjusting counters as each comment goes. Callers hold m.mu.
+func (m *Memory) deleteComment(commentID int) {
+	for id, c := range m.comments {
+		if c.ParentCommentID != nil && *c.ParentCommentID == commentID {
+			m.deleteComment(id)
+		}
+	}
+	m.interactions = slices.DeleteFunc(m.interactions, func(row models.UserTweetInteraction) bool {
+		return row.CommentID != nil && *row.CommentID == commentID
+	})
+	m.revisions = slices.DeleteFunc(m.revisions, func(r models.Revision) bool {
+		return r.CommentID != nil && *r.CommentID == commentID
+	})
+	m.mentions = slices.DeleteFunc(m.mentions, func(row models.Mention) bool {
+		return row.CommentID != nil && *row.CommentID == commentID
+	})
+	m.notifications = slices.DeleteFunc(m.notifications, func(n memoryNotification) bool {
+		return n.CommentID != nil && *n.CommentID == commentID
+	})
+	if c, ok := m.comments[commentID]; ok {
+		delete(m.comments, commentID)
+		m.applyCommentDelta(c, -1)
+	}
+}
+
+func (m *Memory) GetUser(ctx context.Context, userID int) (models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (m *Memory) UsersByUsername(ctx context.Context, usernames []string) (map[string]models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	found := map[string]models.User{}
+	for _, u := range m.users {
+		if name := strings.ToLower(u.Username); slices.Contains(usernames, name) {
+			found[name] = u
+		}
+	}
+	return found, nil
+}
+
+func (m *Memory) GetProfile(ctx context.Context, userID int) (models.Profile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return models.Profile{}, ErrNotFound
+	}
+	p := models.Profile{User: u}
+	for _, f := range m.follows {
+		if f.FollowingUserID == userID {
+			p.Followers++
+		}
+		if f.UserID == userID {
+			p.Following++
+		}
+	}
+	return p, nil
+}
+
+func (m *Memory) UpdateBio(ctx context.Context, userID int, bio string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.Bio = bio
+	m.users[userID] = u
+	return nil
+}
+
+// interaction returns the row for a user and target, or nil. Callers hold m.mu.
+func (m *Memory) interaction(userID int, target Target) *models.UserTweetInteraction {
+	for i := range m.interactions {
+		row := &m.interactions[i]
+		if row.UserID != userID {
+			continue
+		}
+		if target.IsComment && row.CommentID != nil && *row.CommentID == target.ID {
+			return row
+		}
+		if !target.IsComment && row.CommentID == nil && row.TweetID != nil && *row.TweetID == target.ID {
+			return row
+		}
+	}
+	return nil
+}
+
+func (m *Memory) SetInteraction(ctx context.Context, userID int, target Target, kind Interaction, active bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	row := m.interaction(userID, target)
+	if row == nil {
+		if !active {
+			return false, nil
+		}
+		if _, ok := m.users[userID]; !ok {
+			return false, fmt.Errorf("user %d: %w", userID, ErrNotFound)
+		}
+		id := target.ID
+		n := models.UserTweetInteraction{ID: m.nextInteractionID, UserID: userID, CreatedAt: time.Now().UTC()}
+		if target.IsComment {
+			if _, ok := m.comments[id]; !ok {
+				return false, fmt.Errorf("comment %d: %w", id, ErrNotFound)
+			}
+			n.CommentID = &id
+		} else {
+			if _, ok := m.tweets[id]; !ok {
+				return false, fmt.Errorf("tweet %d: %w", id, ErrNotFound)
+			}
+			n.TweetID = &id
+		}
+		m.nextInteractionID++
+		m.interactions = append(m.interactions, n)
+		row = &m.interactions[len(m.interactions)-1]
+	}
+	var flag *bool
+	switch kind {
+	case Like:
+		flag = &row.IsLiked
+	case Save:
+		flag = &row.IsSaved
+	case Restack:
+		flag = &row.IsRestacked
+	default:
+		return false, fmt.Errorf("unknown interaction %q", kind)
+	}
+	if *flag == active {
+		return false, nil
+	}
+	*flag = active
+	switch kind {
+	case Like:
+		row.LikedAt = nil
+		if active {
+			now := time.Now().UTC()
+			row.LikedAt = &now
+		}
+	case Restack:
+		row.RestackedAt = nil
+		if active {
+			now := time.Now().UTC()
+			row.RestackedAt = &now
+		}
+	case Save:
+		row.SavedAt, row.FolderID = nil, nil
+		if active {
+			now := time.Now().UTC()
+			row.SavedAt = &now
+		}
+	}
+	delta := 1
+	if !active {
+		delta = -1
+	}
+	m.applyInteractionDelta(*row, kind, delta)
+	if kind == Like || kind == Restack {
+		notification := models.NotifyLike
+		if kind == Restack {
+			notification = models.NotifyRestack
+		}
+		if author, ok := m.author(target); ok && active {
+			m.notify(author, userID, notification, &target)
+		} else if ok {
+			m.unnotify(author, userID, notification, &target)
+		}
+	}
+	return true, nil
+}
+
+func (m *Memory) ViewerStates(ctx context.Context, userID int, targets []Target) (map[Target]models.ViewerState, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	states := make(map[Target]models.ViewerState, len(targets))
+	for _, target := range targets {
+		if row := m.interaction(userID, target); row != nil {
+			states[target] = viewerState(*row)
+		}
+	}
+	return states, nil
+}
+
+func (m *Memory) LikedItems(ctx context.Context, userID int, page Page) ([]models.LikedItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var rows []models.UserTweetInteraction
+	for _, row := range m.interactions {
+		if row.UserID == userID && row.IsLiked && row.LikedAt != nil && page.Before.before(*row.LikedAt, row.ID) {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return newestFirst(*rows[i].LikedAt, rows[i].ID, *rows[j].LikedAt, rows[j].ID)
+	})
+	if len(rows) > page.Limit {
+		rows = rows[:page.Limit]
+	}
+	tweets := map[int]models.TweetWithUser{}
+	comments := map[int]models.CommentWithUser{}
+	for _, row := range rows {
+		if row.CommentID != nil {
+			if c, ok := m.comments[*row.CommentID]; ok {
+				comments[c.ID] = m.commentWithUser(c)
+			}
+		} else if row.TweetID != nil {
+			if t, ok := m.tweets[*row.TweetID]; ok {
+				tweets[t.ID] = m.tweetWithUser(t)
+			}
+		}
+	}
+	return assembleLikes(rows, tweets, comments), nil
+}
+
+func (m *Memory) Mentions(ctx context.Context, userID int, page Page) ([]models.MentionItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var rows []models.Mention
+	for _, row := range m.mentions {
+		if row.UserID == userID && page.Before.before(row.CreatedAt, row.ID) {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return newestFirst(rows[i].CreatedAt, rows[i].ID, rows[j].CreatedAt, rows[j].ID)
+	})
+	if len(rows) > page.Limit {
+		rows = rows[:page.Limit]
+	}
+	tweets := map[int]models.TweetWithUser{}
+	comments := map[int]models.CommentWithUser{}
+	for _, row := range rows {
+		if row.CommentID != nil {
+			if c, ok := m.comments[*row.CommentID]; ok {
+				comments[c.ID] = m.commentWithUser(c)
+			}
+		} else if row.TweetID != nil {
+			if t, ok := m.tweets[*row.TweetID]; ok {
+				tweets[t.ID] = m.tweetWithUser(t)
+			}
+		}
+	}
+	return assembleMentions(rows, tweets, comments), nil
+}
+
+func (m *Memory) Interactors(ctx context.Context, target Target, kind Interaction, page Page) ([]models.InteractionEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if target.IsComment {
+		if _, ok := m.comments[target.ID]; !ok {
+			return nil, ErrNotFound
+		}
+	} else if _, ok := m.tweets[target.ID]; !ok {
+		return nil, ErrNotFound
+	}
+	entries := make([]models.InteractionEntry, 0)
+	for _, row := range m.interactions {
+		if t, ok := interactionTarget(row); !ok || t != target {
+			continue
+		}
+		var at *time.Time
+		switch kind {
+		case Like:
+			if row.IsLiked {
+				at = row.LikedAt
+			}
+		case Restack:
+			if row.IsRestacked {
+				at = row.RestackedAt
+			}
+		default:
+			return nil, fmt.Errorf("unsupported interaction %q", kind)
+		}
+		if at != nil && page.Before.before(*at, row.UserID) {
+			entries = append(entries, models.InteractionEntry{User: m.users[row.UserID], InteractedAt: *at})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return newestFirst(entries[i].InteractedAt, entries[i].ID, entries[j].InteractedAt, entries[j].ID)
+	})
+	if len(entries) > page.Limit {
+		entries = entries[:page.Limit]
+	}
+	return entries, nil
+}
+
+// applyInteractionDelta adjusts the counter kind on the target of row, which
+// is its comment when set and its tweet otherwise. Callers hold m.mu.
+func (m *Memory) applyInteractionDelta(row models.UserTweetInteraction, kind Interaction, delta int) {
+	if row.CommentID != nil {
+		c, ok := m.comments[*row.CommentID]
+		if ok && kind == Like {
+			c.Likes += delta
+			m.comments[c.ID] = c
+		}
+		return
+	}
+	if row.TweetID == nil {
+		return
+	}
+	t, ok := m.tweets[*row.TweetID]
+	if !ok {
+		return
+	}
+	switch kind {
+	case Like:
+		t.Likes += delta
+	case Save:
+		t.Saves += delta
+	case Restack:
+		t.Restacks += delta
+	}
+	m.tweets[t.ID] = t
+}
+
+func (m *Memory) ReconcileCounters(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tweets := make(map[int]models.Tweet, len(m.tweets))
+	for id, t := range m.tweets {
+		t.Likes, t.Saves, t.Restacks, t.Comments, t.Replies = 0, 0, 0, 0, 0
+		tweets[id] = t
+	}
+	comments := make(map[int]models.Comment, len(m.comments))
+	for id, c := range m.comments {
+		c.Likes, c.Replies = 0, 0
+		comments[id] = c
+	}
+	for _, row := range m.interactions {
+		if row.CommentID != nil {
+			if c, ok := comments[*row.CommentID]; ok && row.IsLiked {
+				c.Likes++
+				comments[c.ID] = c
+			}
+			continue
+		}
+		if row.TweetID == nil {
+			continue
+		}
+		if t, ok := tweets[*row.TweetID]; ok {
+			if row.IsLiked {
+				t.Likes++
+			}
+			if row.IsSaved {
+				t.Saves++
+			}
+			if row.IsRestacked {
+				t.Restacks++
+			}
+			tweets[t.ID] = t
+		}
+	}
+	for _, c := range m.comments {
+		if t, ok := tweets[c.TweetID]; ok {
+			t.Comments++
+			if c.ParentCommentID == nil {
+				t.Replies++
+			}
+			tweets[t.ID] = t
+		}
+		if c.ParentCommentID != nil {
+			if parent, ok := comments[*c.ParentCommentID]; ok {
+				parent.Replies++
+				comments[parent.ID] = parent
+			}
+		}
+	}
+
+	changed := 0
+	for id, t := range tweets {
+		if t != m.tweets[id] {
+			changed++
+		}
+		m.tweets[id] = t
+	}
+	for id, c := range comments {
+		if c != m.comments[id] {
+			changed++
+		}
+		m.comments[id] = c
+	}
+	return changed, nil
+}
+
+func (m *Memory) SavedTweets(ctx context.Context, userID int, folderID *int, page Page) ([]models.SavedTweet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if folderID != nil {
+		if f, ok := m.folders[*folderID]; !ok || f.UserID != userID {
+			return nil, fmt.Errorf("folder %d: %w", *folderID, ErrNotFound)
+		}
+	}
+	saved := make([]models.SavedTweet, 0)
+	for _, row := range m.interactions {
+		if row.UserID != userID || !row.IsSaved || row.CommentID != nil || row.TweetID == nil || row.SavedAt == nil {
+			continue
+		}
+		if folderID != nil && (row.FolderID == nil || *row.FolderID != *folderID) {
+			continue
+		}
+		t, ok := m.tweets[*row.TweetID]
+		if !ok || !page.Before.before(*row.SavedAt, t.ID) {
+			continue
+		}
+		saved = append(saved, models.SavedTweet{TweetWithUser: m.tweetWithUser(t), SavedAt: *row.SavedAt, FolderID: row.FolderID})
+	}
+	sort.Slice(saved, func(i, j int) bool {
+		return newestFirst(saved[i].SavedAt, saved[i].ID, saved[j].SavedAt, saved[j].ID)
+	})
+	if len(saved) > page.Limit {
+		saved = saved[:page.Limit]
+	}
+	return saved, nil
+}
+
+func (m *Memory) BookmarkFolders(ctx context.Context, userID int) ([]models.BookmarkFolder, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	folders := make([]models.BookmarkFolder, 0)
+	for _, f := range m.folders {
+		if f.UserID == userID {
+			folders = append(folders, f)
+		}
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		if folders[i].Name != folders[j].Name {
+			return folders[i].Name < folders[j].Name
+		}
+		return folders[i].ID < folders[j].ID
+	})
+	return folders, nil
+}
+
+func (m *Memory) CreateBookmarkFolder(ctx context.Context, userID int, name string) (models.BookmarkFolder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[userID]; !ok {
+		return models.BookmarkFolder{}, fmt.Errorf("user %d: %w", userID, ErrNotFound)
+	}
+	for _, f := range m.folders {
+		if f.UserID == userID && f.Name == name {
+			return models.BookmarkFolder{}, fmt.Errorf("folder %q: %w", name, ErrConflict)
+		}
+	}
+	f := models.BookmarkFolder{ID: m.nextFolderID, UserID: userID, Name: name, CreatedAt: time.Now().UTC()}
+	m.nextFolderID++
+	m.folders[f.ID] = f
+	return f, nil
+}
+
+func (m *Memory) DeleteBookmarkFolder(ctx context.Context, userID, folderID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.folders[folderID]
+	if !ok {
+		return ErrNotFound
+	}
+	if f.UserID != userID {
+		return ErrForbidden
+	}
+	delete(m.folders, folderID)
+	for i := range m.interactions {
+		if row := &m.interactions[i]; row.FolderID != nil && *row.FolderID == folderID {
+			row.FolderID = nil
+		}
+	}
+	return nil
+}
+
+func (m *Memory) FileSave(ctx context.Context, userID, tweetID int, folderID *int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if folderID != nil {
+		if f, ok := m.folders[*folderID]; !ok || f.UserID != userID {
+			return fmt.Errorf("folder %d: %w", *folderID, ErrNotFound)
+		}
+	}
+	row := m.interaction(userID, Target{ID: tweetID})
+	if row == nil || !row.IsSaved {
+		return fmt.Errorf("saved tweet %d: %w", tweetID, ErrNotFound)
+	}
+	row.FolderID = nil
+	if folderID != nil {
+		id := *folderID
+		row.FolderID = &id
+	}
+	return nil
+}
+
+// author returns the user who wrote target. Callers hold m.mu.
+func (m *Memory) author(target Target) (int, bool) {
+	if target.IsComment {
+		c, ok := m.comments[target.ID]
+		return c.UserID, ok
+	}
+	t, ok := m.tweets[target.ID]
+	return t.UserID, ok
+}
+
+// notifies reports whether n is about target, or about no target when
+// target is nil.
+func (n *memoryNotification) notifies(recipient int, kind string, target *Target) bool {
+	if n.UserID != recipient || n.Kind != kind {
+		return false
+	}
+	switch {
+	case target == nil:
+		return n.TweetID == nil && n.CommentID == nil
+	case target.IsComment:
+		return n.CommentID != nil && *n.CommentID == target.ID
+	default:
+		return n.CommentID == nil && n.TweetID != nil && *n.TweetID == target.ID
+	}
+}
+
+// notify adds actor to recipient's unread notification of kind on target as
+// sql/notifications.sql does, starting one when there is none. Callers hold
+// m.mu.
+func (m *Memory) notify(recipient, actor int, kind string, target *Target) {
+	if recipient == actor {
+		return
+	}
+	now := time.Now().UTC()
+	var n *memoryNotification
+	for i := range m.notifications {
+		if m.notifications[i].ReadAt == nil && m.notifications[i].notifies(recipient, kind, target) {
+			n = &m.notifications[i]
+			break
+		}
+	}
+	if n == nil {
+		row := notificationRow{ID: m.nextNotificationID, UserID: recipient, Kind: kind, CreatedAt: now}
+		if target != nil {
+			id := target.ID
+			if target.IsComment {
+				row.CommentID = &id
+			} else {
+				row.TweetID = &id
+			}
+		}
+		m.nextNotificationID++
+		m.notifications = append(m.notifications, memoryNotification{notificationRow: row})
+		n = &m.notifications[len(m.notifications)-1]
+	}
+	n.UpdatedAt = now
+	n.actors = slices.DeleteFunc(n.actors, func(a notificationActor) bool { return a.ActorID == actor })
+	n.actors = append(n.actors, notificationActor{ActorID: actor, CreatedAt: now})
+}
+
+// unnotify takes actor out of recipient's notifications of kind on target,
+// dropping those left without actors. Callers hold m.mu.
+func (m *Memory) unnotify(recipient, actor int, kind string, target *Target) {
+	for i := range m.notifications {
+		if n := &m.notifications[i]; n.notifies(recipient, kind, target) {
+			n.actors = slices.DeleteFunc(n.actors, func(a notificationActor) bool { return a.ActorID == actor })
+		}
+	}
+	m.notifications = slices.DeleteFunc(m.notifications, func(n memoryNotification) bool {
+		return len(n.actors) == 0
+	})
+}
+
+func (m *Memory) Notifications(ctx context.Context, userID int, page Page) ([]models.Notification, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var rows []notificationRow
+	for _, n := range m.notifications {
+		if n.UserID != userID || !page.Before.before(n.UpdatedAt, n.ID) {
+			continue
+		}
+		actors := slices.Clone(n.actors)
+		sort.Slice(actors, func(i, j int) bool {
+			return newestFirst(actors[i].CreatedAt, actors[i].ActorID, actors[j].CreatedAt, actors[j].ActorID)
+		})
+		row := n.notificationRow
+		row.ActorCount, row.ActorIDs = len(actors), nil
+		for _, a := range actors[:min(len(actors), notificationActorLimit)] {
+			row.ActorIDs = append(row.ActorIDs, a.ActorID)
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return newestFirst(rows[i].UpdatedAt, rows[i].ID, rows[j].UpdatedAt, rows[j].ID)
+	})
+	if len(rows) > page.Limit {
+		rows = rows[:page.Limit]
+	}
+	tweets := map[int]models.TweetWithUser{}
+	comments := map[int]models.CommentWithUser{}
+	for _, row := range rows {
+		if row.CommentID != nil {
+			if c, ok := m.comments[*row.CommentID]; ok {
+				comments[c.ID] = m.commentWithUser(c)
+			}
+		} else if row.TweetID != nil {
+			if t, ok := m.tweets[*row.TweetID]; ok {
+				tweets[t.ID] = m.tweetWithUser(t)
+			}
+		}
+	}
+	return assembleNotifications(rows, m.users, tweets, comments), nil
+}
+
+func (m *Memory) UnreadNotifications(ctx context.Context, userID int) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	unread := 0
+	for _, n := range m.notifications {
+		if n.UserID == userID && n.ReadAt == nil {
+			unread++
+		}
+	}
+	return unread, nil
+}
+
+func (m *Memory) MarkNotificationsRead(ctx context.Context, userID int, ids []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	for i := range m.notifications {
+		n := &m.notifications[i]
+		if n.UserID == userID && n.ReadAt == nil && (ids == nil || slices.Contains(ids, n.ID)) {
+			n.ReadAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Follow(ctx context.Context, userID, followID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range []int{userID, followID} {
+		if _, ok := m.users[id]; !ok {
+			return fmt.Errorf("user %d: %w", id, ErrNotFound)
+		}
+	}
+	for _, f := range m.follows {
+		if f.UserID == userID && f.FollowingUserID == followID {
+			return nil
+		}
+	}
+	m.follows = append(m.follows, follow{UserID: userID, FollowingUserID: followID, CreatedAt: time.Now().UTC()})
+	m.notify(followID, userID, models.NotifyFollow, nil)
+	return nil
+}
+
+func (m *Memory) Unfollow(ctx context.Context, userID, followID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, f := range m.follows {
+		if f.UserID == userID && f.FollowingUserID == followID {
+			m.follows = append(m.follows[:i], m.follows[i+1:]...)
+			m.unnotify(followID, userID, models.NotifyFollow, nil)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Followers(ctx context.Context, userID int, page Page) ([]models.FollowEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.followEntries(page, func(f follow) (int, bool) {
+		return f.UserID, f.FollowingUserID == userID
+	}), nil
+}
+
+func (m *Memory) Following(ctx context.Context, userID int, page Page) ([]models.FollowEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.followEntries(page, func(f follow) (int, bool) {
+		return f.FollowingUserID, f.UserID == userID
+	}), nil
+}
+
+// followEntries returns a page of the users that pick selects from the follow
+// graph, most recent follow first. Callers hold m.mu.
+func (m *Memory) followEntries(page Page, pick func(follow) (int, bool)) []models.FollowEntry {
+	entries := make([]models.FollowEntry, 0)
+	for _, f := range m.follows {
+		id, ok := pick(f)
+		if ok && page.Before.before(f.CreatedAt, id) {
+			entries = append(entries, models.FollowEntry{User: m.users[id], FollowedAt: f.CreatedAt})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return newestFirst(entries[i].FollowedAt, entries[i].ID, entries[j].FollowedAt, entries[j].ID)
+	})
+	if len(entries) > page.Limit {
+		entries = entries[:page.Limit]
+	}
+	return entries
+}
+
+// searchFilter reports whether a row by userID created at createdAt with the
+// given reply count passes the operators of q. Callers hold m.mu.
+func (m *Memory) searchFilter(q SearchQuery, userID int, createdAt time.Time, replies int) bool {
+	if q.From != "" && !strings.EqualFold(m.users[userID].Username, q.From) {
+		return false
+	}
+	if q.Before != nil && !createdAt.Before(*q.Before) {
+		return false
+	}
+	if q.After != nil && createdAt.Before(*q.After) {
+		return false
+	}
+	return !q.HasReplies || replies > 0
+}
+
+// ranked is a search hit awaiting ordering.
+type ranked[T any] struct {
+	rank      int
+	createdAt time.Time
+	id        int
+	row       T
+}
+
+// searchPage orders hits best match first, then newest first, and returns
+// the window limit and offset select.
+func searchPage[T any](hits []ranked[T], limit, offset int) []T {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].rank != hits[j].rank {
+			return hits[i].rank > hits[j].rank
+		}
+		return newestFirst(hits[i].createdAt, hits[i].id, hits[j].createdAt, hits[j].id)
+	})
+	out := make([]T, 0)
+	for i := offset; i < len(hits) && len(out) < limit; i++ {
+		out = append(out, hits[i].row)
+	}
+	return out
+}
+
+func (m *Memory) SearchTweets(ctx context.Context, q SearchQuery, limit, offset int) ([]models.TweetWithUser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var hits []ranked[models.TweetWithUser]
+	for _, t := range m.tweets {
+		rank := searchRank(q, t.Body)
+		if (q.HasText() && rank == 0) || !m.searchFilter(q, t.UserID, t.CreatedAt, t.Comments) {
+			continue
+		}
+		hits = append(hits, ranked[models.TweetWithUser]{rank, t.CreatedAt, t.ID, m.tweetWithUser(t)})
+	}
+	return searchPage(hits, limit, offset), nil
+}
+
+func (m *Memory) SearchComments(ctx context.Context, q SearchQuery, limit, offset int) ([]models.CommentWithUser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var hits []ranked[models.CommentWithUser]
+	for _, c := range m.comments {
+		rank := searchRank(q, c.Body)
+		if (q.HasText() && rank == 0) || !m.searchFilter(q, c.UserID, c.CreatedAt, c.Replies) {
+			continue
+		}
+		hits = append(hits, ranked[models.CommentWithUser]{rank, c.CreatedAt, c.ID, m.commentWithUser(c)})
+	}
+	return searchPage(hits, limit, offset), nil
+}
+
+func (m *Memory) SearchUsers(ctx context.Context, q SearchQuery, limit, offset int) ([]models.User, error) {
+	if !q.HasText() || q.HasOperators() {
+		return []models.User{}, nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var hits []ranked[models.User]
+	for _, u := range m.users {
+		if rank := searchRank(q, u.Username+" "+u.ProfileName+" "+u.Bio); rank > 0 {
+			hits = append(hits, ranked[models.User]{rank, u.CreatedAt, u.ID, u})
+		}
+	}
+	return searchPage(hits, limit, offset), nil
+}
+
+func (m *Memory) SessionUser(ctx context.Context, sessionToken string) (string, time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[sessionToken]
+	if !ok {
+		return "", time.Time{}, ErrNotFound
+	}
+	return s.AuthUserID, s.Expires, nil
+}
+
+func (m *Memory) UserIDForAuthUser(ctx context.Context, authUserID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	id, ok := m.authUsers[authUserID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return id, nil
+}
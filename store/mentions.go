@@ -0,0 +1,42 @@
+package store
+
+import "github.com/et-hicks/imitation-backend/models"
+
+// mentionTargetIDs separates the tweet and comment ids named by mention rows.
+func mentionTargetIDs(rows []models.Mention) (tweetIDs, commentIDs []int) {
+	for _, row := range rows {
+		if row.CommentID != nil {
+			commentIDs = append(commentIDs, *row.CommentID)
+		} else if row.TweetID != nil {
+			tweetIDs = append(tweetIDs, *row.TweetID)
+		}
+	}
+	return tweetIDs, commentIDs
+}
+
+// assembleMentions pairs mention rows, in listing order, with the tweets and
+// comments they name. Rows whose target is missing are dropped.
+func assembleMentions(rows []models.Mention, tweets map[int]models.TweetWithUser, comments map[int]models.CommentWithUser) []models.MentionItem {
+	items := make([]models.MentionItem, 0, len(rows))
+	for _, row := range rows {
+		item := models.MentionItem{ID: row.ID, Kind: models.MentionTweet, MentionedAt: row.CreatedAt}
+		switch {
+		case row.CommentID != nil:
+			c, ok := comments[*row.CommentID]
+			if !ok {
+				continue
+			}
+			item.Kind, item.Comment = models.MentionComment, &c
+		case row.TweetID != nil:
+			t, ok := tweets[*row.TweetID]
+			if !ok {
+				continue
+			}
+			item.Tweet = &t
+		default:
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/et-hicks/imitation-backend/models"
+)
+
+// notificationActorLimit is how many of a notification's actors are listed.
+const notificationActorLimit = 3
+
+// notificationRow is a row of notifications_page in sql/notifications.sql: a
+// notification with its actor count and the ids of its latest actors.
+type notificationRow struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Kind       string     `json:"kind"`
+	TweetID    *int       `json:"tweet_id"`
+	CommentID  *int       `json:"comment_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ReadAt     *time.Time `json:"read_at"`
+	ActorCount int        `json:"actor_count"`
+	ActorIDs   []int      `json:"actor_ids"`
+}
+
+// notificationRefs returns the tweet, comment and actor ids rows name.
+func notificationRefs(rows []notificationRow) (tweetIDs, commentIDs, actorIDs []int) {
+	for _, row := range rows {
+		if row.CommentID != nil {
+			commentIDs = append(commentIDs, *row.CommentID)
+		} else if row.TweetID != nil {
+			tweetIDs = append(tweetIDs, *row.TweetID)
+		}
+		actorIDs = append(actorIDs, row.ActorIDs...)
+	}
+	return tweetIDs, commentIDs, actorIDs
+}
+
+// assembleNotifications pairs notification rows, in listing order, with their
+// actors and targets. Actors that no longer exist are skipped.
+func assembleNotifications(rows []notificationRow, users map[int]models.User, tweets map[int]models.TweetWithUser, comments map[int]models.CommentWithUser) []models.Notification {
+	out := make([]models.Notification, 0, len(rows))
+	for _, row := range rows {
+		n := models.Notification{
+			ID:         row.ID,
+			Kind:       row.Kind,
+			Actors:     []models.User{},
+			ActorCount: row.ActorCount,
+			Read:       row.ReadAt != nil,
+			CreatedAt:  row.CreatedAt,
+			UpdatedAt:  row.UpdatedAt,
+		}
+		for _, id := range row.ActorIDs {
+			if u, ok := users[id]; ok {
+				n.Actors = append(n.Actors, u)
+			}
+		}
+		if row.CommentID != nil {
+			if c, ok := comments[*row.CommentID]; ok {
+				n.Comment = &c
+			}
+		} else if row.TweetID != nil {
+			if t, ok := tweets[*row.TweetID]; ok {
+				n.Tweet = &t
+			}
+		}
+		n.Summary = notificationSummary(n)
+		out = append(out, n)
+	}
+	return out
+}
+
+// notificationSummary describes n in a sentence such as "Ana and 4 others
+// liked your tweet".
+func notificationSummary(n models.Notification) string {
+	who := "Someone"
+	if len(n.Actors) > 0 {
+		who = displayName(n.Actors[0])
+	}
+	switch {
+	case n.ActorCount == 2 && len(n.Actors) == 2:
+		who += " and " + displayName(n.Actors[1])
+	case n.ActorCount == 2:
+		who += " and 1 other"
+	case n.ActorCount > 2:
+		who += fmt.Sprintf(" and %d others", n.ActorCount-1)
+	}
+	target := "tweet"
+	if n.Comment != nil {
+		target = "comment"
+	}
+	switch n.Kind {
+	case models.NotifyLike:
+		return who + " liked your " + target
+	case models.NotifyRestack:
+		return who + " restacked your " + target
+	case models.NotifyReply:
+		return who + " replied to your " + target
+	case models.NotifyFollow:
+		return who + " followed you"
+	case models.NotifyMention:
+		return who + " mentioned you in a " + target
+	}
+	return who + " interacted with you"
+}
+
+// displayName is a user's profile name, or their username without one.
+func displayName(u models.User) string {
+	if u.ProfileName != "" {
+		return u.ProfileName
+	}
+	return u.Username
+}
@@ -0,0 +1,962 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/et-hicks/imitation-backend/models"
+	postgrest "github.com/supabase-community/postgrest-go"
+	supabase "github.com/supabase-community/supabase-go"
+)
+
+// PostgREST is a Store backed by Supabase's PostgREST API.
+type PostgREST struct {
+	client   *supabase.Client
+	nextAuth *supabase.Client
+}
+
+var _ Store = (*PostgREST)(nil)
+
+// NewPostgREST returns a Store using client for the public schema and
+// nextAuth for the next_auth schema.
+func NewPostgREST(client, nextAuth *supabase.Client) *PostgREST {
+	return &PostgREST{client: client, nextAuth: nextAuth}
+}
+
+// translateError maps PostgREST's "no rows for a single object" error and
+// foreign key violations to ErrNotFound and unique violations to
+// ErrConflict, as translatePgError does for Postgres.
+func translateError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case strings.HasPrefix(err.Error(), "(PGRST116)"):
+		return ErrNotFound
+	case strings.HasPrefix(err.Error(), "(23503)"):
+		return fmt.Errorf("%s: %w", err, ErrNotFound)
+	case strings.HasPrefix(err.Error(), "(23505)"):
+		return fmt.Errorf("%s: %w", err, ErrConflict)
+	}
+	return err
+}
+
+// paginate orders qb newest first and applies page's keyset and limit.
+func paginate(qb *postgrest.FilterBuilder, page Page) *postgrest.FilterBuilder {
+	return paginateBy(qb, page, "created_at", "id")
+}
+
+// paginateBy is paginate for tables whose keyset is (timeColumn, idColumn).
+func paginateBy(qb *postgrest.FilterBuilder, page Page, timeColumn, idColumn string) *postgrest.FilterBuilder {
+	if c := page.Before; c != nil {
+		ts := c.CreatedAt.UTC().Format(time.RFC3339Nano)
+		qb = qb.Or(fmt.Sprintf(`%[1]s.lt."%[3]s",and(%[1]s.eq."%[3]s",%[2]s.lt.%[4]d)`, timeColumn, idColumn, ts, c.ID), "")
+	}
+	qb = qb.Order(timeColumn, &postgrest.OrderOpts{Ascending: false})
+	qb = qb.Order(idColumn, &postgrest.OrderOpts{Ascending: false})
+	return qb.Limit(page.Limit, "")
+}
+
+func (s *PostgREST) LatestTweets(ctx context.Context, page Page) ([]models.TweetWithUser, error) {
+	var tweets []models.TweetWithUser
+	qb := s.client.From("tweets").Select("*,users(*)", "", false)
+	qb = paginate(qb, page)
+	if _, err := qb.ExecuteTo(&tweets); err != nil {
+		return nil, err
+	}
+	return tweets, nil
+}
+
+func (s *PostgREST) UserFeed(ctx context.Context, userID int, page Page) ([]models.FeedItem, error) {
+	return s.feed("user_feed", map[string]interface{}{"author": userID}, page)
+}
+
+func (s *PostgREST) HashtagTweets(ctx context.Context, tag string, page Page) ([]models.TweetWithUser, error) {
+	var tweets []models.TweetWithUser
+	qb := s.client.From("tweets").Select("*,users(*),tweet_hashtags!inner(tag)", "", false)
+	qb = qb.Eq("tweet_hashtags.tag", tag)
+	qb = paginate(qb, page)
+	if _, err := qb.ExecuteTo(&tweets); err != nil {
+		return nil, err
+	}
+	return tweets, nil
+}
+
+func (s *PostgREST) GetTweet(ctx context.Context, tweetID int) (models.TweetWithUser, error) {
+	var tweet models.TweetWithUser
+	qb := s.client.From("tweets").Select("*,users(*)", "", false)
+	qb = qb.Eq("id", strconv.Itoa(tweetID))
+	data, _, err := qb.Single().Execute()
+	if err != nil {
+		return tweet, translateError(err)
+	}
+	err = json.Unmarshal(data, &tweet)
+	return tweet, err
+}
+
+func (s *PostgREST) CreateTweet(ctx context.Context, userID int, body string) (models.Tweet, error) {
+	var tweet models.Tweet
+	qb := s.client.From("tweets").Insert(map[string]interface{}{
+		"user_id": userID,
+		"body":    body,
+	}, false, "", "", "")
+	data, _, err := qb.Single().Execute()
+	if err != nil {
+		return tweet, translateError(err)
+	}
+	err = json.Unmarshal(data, &tweet)
+	return tweet, err
+}
+
+// rpc calls a database function and decodes its JSON result into out.
+func (s *PostgREST) rpc(name string, args map[string]interface{}, out interface{}) error {
+	result := s.client.Rpc(name, "", args)
+	if err := json.Unmarshal([]byte(result), out); err != nil {
+		var execErr postgrest.ExecuteError
+		if json.Unmarshal([]byte(result), &execErr) == nil && execErr.Message != "" {
+			return translateError(fmt.Errorf("(%s) %s", execErr.Code, execErr.Message))
+		}
+		return fmt.Errorf("%s: unexpected response %q", name, result)
+	}
+	return nil
+}
+
+// idList renders ids for an in.() filter.
+func idList(ids []int) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = strconv.Itoa(id)
+	}
+	return out
+}
+
+func (s *PostgREST) FollowingTimeline(ctx context.Context, viewerID int, page Page) ([]models.FeedItem, error) {
+	return s.feed("following_timeline", map[string]interface{}{"viewer": viewerID}, page)
+}
+
+// feed reads a page from one of the feed functions in sql/timeline.sql, then
+// loads the tweets and restacking users it names.
+func (s *PostgREST) feed(fn string, args map[string]interface{}, page Page) ([]models.FeedItem, error) {
+	args["before_at"] = nil
+	args["before_id"] = nil
+	args["before_by"] = nil
+	args["page_size"] = page.Limit
+	if c := page.Before; c != nil {
+		args["before_at"] = c.CreatedAt.UTC().Format(time.RFC3339Nano)
+		args["before_id"] = c.ID
+		if c.RestackedBy != 0 {
+			args["before_by"] = c.RestackedBy
+		}
+	}
+	var entries []struct {
+		TweetID     int       `json:"tweet_id"`
+		FeedAt      time.Time `json:"feed_at"`
+		RestackedBy *int      `json:"restacked_by"`
+	}
+	if err := s.rpc(fn, args, &entries); err != nil {
+		return nil, err
+	}
+	items := make([]models.FeedItem, 0, len(entries))
+	if len(entries) == 0 {
+		return items, nil
+	}
+
+	var tweetIDs, userIDs []int
+	for _, e := range entries {
+		tweetIDs = append(tweetIDs, e.TweetID)
+		if e.RestackedBy != nil {
+			userIDs = append(userIDs, *e.RestackedBy)
+		}
+	}
+	var tweets []models.TweetWithUser
+	if _, err := s.client.From("tweets").Select("*,users(*)", "", false).In("id", idList(tweetIDs)).ExecuteTo(&tweets); err != nil {
+		return nil, err
+	}
+	byID := make(map[int]models.TweetWithUser, len(tweets))
+	for _, t := range tweets {
+		byID[t.ID] = t
+	}
+	users := map[int]models.User{}
+	if len(userIDs) > 0 {
+		var rows []models.User
+		if _, err := s.client.From("users").Select("*", "", false).In("id", idList(userIDs)).ExecuteTo(&rows); err != nil {
+			return nil, err
+		}
+		for _, u := range rows {
+			users[u.ID] = u
+		}
+	}
+
+	for _, e := range entries {
+		t, ok := byID[e.TweetID]
+		if !ok {
+			continue
+		}
+		item := models.FeedItem{TweetWithUser: t, Kind: models.FeedTweet, FeedAt: e.FeedAt}
+		if e.RestackedBy != nil {
+			u := users[*e.RestackedBy]
+			item.Kind, item.RestackedBy = models.FeedRestack, &u
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (s *PostgREST) TweetComments(ctx context.Context, tweetID int, page Page) ([]models.CommentWithUser, error) {
+	var comments []models.CommentWithUser
+	qb := s.client.From("comments").Select("*,users(*)", "", false)
+	qb = qb.Eq("tweet_id", strconv.Itoa(tweetID)).Is("parent_comment_id", "null")
+	qb = paginate(qb, page)
+	if _, err := qb.ExecuteTo(&comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (s *PostgREST) CreateComment(ctx context.Context, userID, tweetID int, body string) (models.Comment, error) {
+	var comment models.Comment
+	qb := s.client.From("comments").Insert(map[string]interface{}{
+		"user_id":  userID,
+		"tweet_id": tweetID,
+		"body":     body,
+	}, false, "", "", "")
+	data, _, err := qb.Single().Execute()
+	if err != nil {
+		return comment, translateError(err)
+	}
+	err = json.Unmarshal(data, &comment)
+	return comment, err
+}
+
+func (s *PostgREST) CreateReply(ctx context.Context, userID, parentCommentID int, body string) (models.Comment, error) {
+	var parents []models.Comment
+	qb := s.client.From("comments").Select("id,tweet_id", "", false)
+	qb = qb.Eq("id", strconv.Itoa(parentCommentID))
+	if _, err := qb.ExecuteTo(&parents); err != nil {
+		return models.Comment{}, err
+	}
+	if len(parents) == 0 {
+		return models.Comment{}, fmt.Errorf("comment %d: %w", parentCommentID, ErrNotFound)
+	}
+
+	var comment models.Comment
+	data, _, err := s.client.From("comments").Insert(map[string]interface{}{
+		"user_id":           userID,
+		"tweet_id":          parents[0].TweetID,
+		"parent_comment_id": parentCommentID,
+		"body":              body,
+	}, false, "", "", "").Single().Execute()
+	if err != nil {
+		return comment, translateError(err)
+	}
+	err = json.Unmarshal(data, &comment)
+	return comment, err
+}
+
+// CommentThread fetches the thread one level at a time.
+func (s *PostgREST) CommentThread(ctx context.Context, commentID, depth int) (models.CommentThread, error) {
+	var roots []models.CommentWithUser
+	qb := s.client.From("comments").Select("*,users(*)", "", false)
+	if _, err := qb.Eq("id", strconv.Itoa(commentID)).ExecuteTo(&roots); err != nil {
+		return models.CommentThread{}, err
+	}
+	if len(roots) == 0 {
+		return models.CommentThread{}, ErrNotFound
+	}
+
+	rows := roots
+	level := []int{commentID}
+	for d := 0; d < depth && len(level) > 0; d++ {
+		var replies []models.CommentWithUser
+		qb := s.client.From("comments").Select("*,users(*)", "", false)
+		if _, err := qb.In("parent_comment_id", idList(level)).ExecuteTo(&replies); err != nil {
+			return models.CommentThread{}, err
+		}
+		level = level[:0]
+		for _, r := range replies {
+			level = append(level, r.ID)
+		}
+		rows = append(rows, replies...)
+	}
+	return assembleThread(roots[0], rows, depth), nil
+}
+
+// exists returns ErrNotFound unless table has a row with id.
+func (s *PostgREST) exists(table string, id int) error {
+	var found []struct {
+		ID int `json:"id"`
+	}
+	if _, err := s.client.From(table).Select("id", "", false).Eq("id", strconv.Itoa(id)).ExecuteTo(&found); err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// edit updates the body of the row id in table when userID wrote it, decoding
+// the updated row into out. The edit history is kept by the triggers in
+// sql/edits.sql.
+func (s *PostgREST) edit(table string, userID, id int, body string, out interface{}) error {
+	qb := s.client.From(table).Update(map[string]string{"body": body}, "representation", "")
+	qb = qb.Eq("id", strconv.Itoa(id)).Eq("user_id", strconv.Itoa(userID))
+	data, _, err := qb.Execute()
+	if err != nil {
+		return err
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		// Nothing matched: tell a missing row from someone else's.
+		if err := s.exists(table, id); err != nil {
+			return err
+		}
+		return ErrForbidden
+	}
+	return json.Unmarshal(rows[0], out)
+}
+
+// remove deletes the row id in table when userID wrote it. Dependent rows go
+// with it through the ON DELETE CASCADE foreign keys in sql/schema.sql.
+func (s *PostgREST) remove(table string, userID, id int) error {
+	qb := s.client.From(table).Delete("representation", "")
+	qb = qb.Eq("id", strconv.Itoa(id)).Eq("user_id", strconv.Itoa(userID))
+	data, _, err := qb.Execute()
+	if err != nil {
+		return err
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		if err := s.exists(table, id); err != nil {
+			return err
+		}
+		return ErrForbidden
+	}
+	return nil
+}
+
+func (s *PostgREST) DeleteTweet(ctx context.Context, userID, tweetID int) error {
+	return s.remove("tweets", userID, tweetID)
+}
+
+func (s *PostgREST) DeleteComment(ctx context.Context, userID, commentID int) error {
+	return s.remove("comments", userID, commentID)
+}
+
+func (s *PostgREST) EditTweet(ctx context.Context, editorID, tweetID int, body string) (models.Tweet, error) {
+	var tweet models.Tweet
+	err := s.edit("tweets", editorID, tweetID, body, &tweet)
+	return tweet, err
+}
+
+func (s *PostgREST) EditComment(ctx context.Context, editorID, commentID int, body string) (models.Comment, error) {
+	var comment models.Comment
+	err := s.edit("comments", editorID, commentID, body, &comment)
+	return comment, err
+}
+
+func (s *PostgREST) History(ctx context.Context, target Target, page Page) ([]models.Revision, error) {
+	table, column := "tweets", "tweet_id"
+	if target.IsComment {
+		table, column = "comments", "comment_id"
+	}
+	if err := s.exists(table, target.ID); err != nil {
+		return nil, err
+	}
+	var revisions []models.Revision
+	qb := s.client.From("edit_history").Select("*", "", false)
+	qb = qb.Eq(column, strconv.Itoa(target.ID))
+	qb = paginate(qb, page)
+	if _, err := qb.ExecuteTo(&revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (s *PostgREST) GetUser(ctx context.Context, userID int) (models.User, error) {
+	var users []models.User
+	qb := s.client.From("users").Select("*", "", false)
+	qb = qb.Eq("id", strconv.Itoa(userID))
+	if _, err := qb.ExecuteTo(&users); err != nil {
+		return models.User{}, err
+	}
+	if len(users) == 0 {
+		return models.User{}, ErrNotFound
+	}
+	return users[0], nil
+}
+
+func (s *PostgREST) GetProfile(ctx context.Context, userID int) (models.Profile, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return models.Profile{}, err
+	}
+	p := models.Profile{User: user}
+	for column, n := range map[string]*int{"following_user_id": &p.Followers, "user_id": &p.Following} {
+		qb := s.client.From("user_following").Select("user_id", "exact", true)
+		_, count, err := qb.Eq(column, strconv.Itoa(userID)).Execute()
+		if err != nil {
+			return models.Profile{}, err
+		}
+		*n = int(count)
+	}
+	return p, nil
+}
+
+func (s *PostgREST) UpdateBio(ctx context.Context, userID int, bio string) error {
+	qb := s.client.From("users").Update(map[string]string{"bio": bio}, "representation", "")
+	qb = qb.Eq("id", strconv.Itoa(userID))
+	data, _, err := qb.Execute()
+	if err != nil {
+		return err
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgREST) UsersByUsername(ctx context.Context, usernames []string) (map[string]models.User, error) {
+	found := map[string]models.User{}
+	if len(usernames) == 0 {
+		return found, nil
+	}
+	var users []models.User
+	if err := s.rpc("users_by_username", map[string]interface{}{"usernames": usernames}, &users); err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		found[strings.ToLower(u.Username)] = u
+	}
+	return found, nil
+}
+
+func (s *PostgREST) Notifications(ctx context.Context, userID int, page Page) ([]models.Notification, error) {
+	args := map[string]interface{}{
+		"viewer":      userID,
+		"before_at":   nil,
+		"before_id":   nil,
+		"page_size":   page.Limit,
+		"actor_limit": notificationActorLimit,
+	}
+	if c := page.Before; c != nil {
+		args["before_at"] = c.CreatedAt.UTC().Format(time.RFC3339Nano)
+		args["before_id"] = c.ID
+	}
+	var rows []notificationRow
+	if err := s.rpc("notifications_page", args, &rows); err != nil {
+		return nil, err
+	}
+	tweetIDs, commentIDs, actorIDs := notificationRefs(rows)
+	users := map[int]models.User{}
+	if len(actorIDs) > 0 {
+		var found []models.User
+		if _, err := s.client.From("users").Select("*", "", false).In("id", idList(actorIDs)).ExecuteTo(&found); err != nil {
+			return nil, err
+		}
+		for _, u := range found {
+			users[u.ID] = u
+		}
+	}
+	tweets, comments, err := s.tweetsAndComments(tweetIDs, commentIDs)
+	if err != nil {
+		return nil, err
+	}
+	return assembleNotifications(rows, users, tweets, comments), nil
+}
+
+func (s *PostgREST) UnreadNotifications(ctx context.Context, userID int) (int, error) {
+	qb := s.client.From("notifications").Select("id", "exact", true)
+	qb = qb.Eq("user_id", strconv.Itoa(userID)).Is("read_at", "null")
+	_, count, err := qb.Execute()
+	return int(count), err
+}
+
+func (s *PostgREST) MarkNotificationsRead(ctx context.Context, userID int, ids []int) error {
+	if ids != nil && len(ids) == 0 {
+		return nil
+	}
+	qb := s.client.From("notifications").Update(map[string]string{"read_at": time.Now().UTC().Format(time.RFC3339Nano)}, "", "")
+	qb = qb.Eq("user_id", strconv.Itoa(userID)).Is("read_at", "null")
+	if ids != nil {
+		qb = qb.In("id", idList(ids))
+	}
+	_, _, err := qb.Execute()
+	return err
+}
+
+// interactionRow narrows qb to userID's interaction row for target.
+func interactionRow(qb *postgrest.FilterBuilder, userID int, target Target) *postgrest.FilterBuilder {
+	qb = qb.Eq("user_id", strconv.Itoa(userID))
+	if target.IsComment {
+		return qb.Eq("comment_id", strconv.Itoa(target.ID))
+	}
+	// Only the tweet's own row, which has no comment_id, as in Postgres.
+	return qb.Eq("tweet_id", strconv.Itoa(target.ID)).Is("comment_id", "null")
+}
+
+func (s *PostgREST) SetInteraction(ctx context.Context, userID int, target Target, kind Interaction, active bool) (bool, error) {
+	column := string(kind)
+	// Flip the flag on the user's row when it is set the other way.
+	qb := s.client.From("user_tweet_interactions").Update(map[string]interface{}{column: active}, "representation", "")
+	qb = interactionRow(qb, userID, target).Is(column, strconv.FormatBool(!active))
+	data, _, err := qb.Execute()
+	if err != nil {
+		return false, translateError(err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return false, err
+	}
+	if len(rows) > 0 || !active {
+		return len(rows) > 0, nil
+	}
+
+	// Otherwise the row is missing or already has the flag set; inserting it
+	// conflicts in the second case.
+	targetColumn := "tweet_id"
+	if target.IsComment {
+		targetColumn = "comment_id"
+	}
+	payload := map[string]interface{}{
+		"user_id":    userID,
+		targetColumn: target.ID,
+		column:       true,
+	}
+	_, _, err = s.client.From("user_tweet_interactions").Insert(payload, false, "", "minimal", "").Execute()
+	if err = translateError(err); errors.Is(err, ErrConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *PostgREST) ViewerStates(ctx context.Context, userID int, targets []Target) (map[Target]models.ViewerState, error) {
+	states := make(map[Target]models.ViewerState, len(targets))
+	tweetIDs, commentIDs := splitTargets(targets)
+	var filters []string
+	if len(tweetIDs) > 0 {
+		filters = append(filters, "and(comment_id.is.null,tweet_id.in.("+strings.Join(idList(tweetIDs), ",")+"))")
+	}
+	if len(commentIDs) > 0 {
+		filters = append(filters, "comment_id.in.("+strings.Join(idList(commentIDs), ",")+")")
+	}
+	if len(filters) == 0 {
+		return states, nil
+	}
+	var rows []models.UserTweetInteraction
+	qb := s.client.From("user_tweet_interactions").Select("tweet_id,comment_id,is_liked,is_saved,is_restacked", "", false)
+	qb = qb.Eq("user_id", strconv.Itoa(userID)).Or(strings.Join(filters, ","), "")
+	if _, err := qb.ExecuteTo(&rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if target, ok := interactionTarget(row); ok {
+			states[target] = viewerState(row)
+		}
+	}
+	return states, nil
+}
+
+func (s *PostgREST) LikedItems(ctx context.Context, userID int, page Page) ([]models.LikedItem, error) {
+	var rows []models.UserTweetInteraction
+	qb := s.client.From("user_tweet_interactions").Select("id,tweet_id,comment_id,liked_at", "", false)
+	qb = qb.Eq("user_id", strconv.Itoa(userID)).Is("is_liked", "true")
+	qb = paginateBy(qb, page, "liked_at", "id")
+	if _, err := qb.ExecuteTo(&rows); err != nil {
+		return nil, err
+	}
+	var tweetIDs, commentIDs []int
+	for _, row := range rows {
+		if row.CommentID != nil {
+			commentIDs = append(commentIDs, *row.CommentID)
+		} else if row.TweetID != nil {
+			tweetIDs = append(tweetIDs, *row.TweetID)
+		}
+	}
+	tweets, comments, err := s.tweetsAndComments(tweetIDs, commentIDs)
+	if err != nil {
+		return nil, err
+	}
+	return assembleLikes(rows, tweets, comments), nil
+}
+
+// tweetsAndComments looks up tweets and comments with their authors by id.
+func (s *PostgREST) tweetsAndComments(tweetIDs, commentIDs []int) (map[int]models.TweetWithUser, map[int]models.CommentWithUser, error) {
+	tweets := map[int]models.TweetWithUser{}
+	if len(tweetIDs) > 0 {
+		var found []models.TweetWithUser
+		if _, err := s.client.From("tweets").Select("*,users(*)", "", false).In("id", idList(tweetIDs)).ExecuteTo(&found); err != nil {
+			return nil, nil, err
+		}
+		for _, t := range found {
+			tweets[t.ID] = t
+		}
+	}
+	comments := map[int]models.CommentWithUser{}
+	if len(commentIDs) > 0 {
+		var found []models.CommentWithUser
+		if _, err := s.client.From("comments").Select("*,users(*)", "", false).In("id", idList(commentIDs)).ExecuteTo(&found); err != nil {
+			return nil, nil, err
+		}
+		for _, c := range found {
+			comments[c.ID] = c
+		}
+	}
+	return tweets, comments, nil
+}
+
+func (s *PostgREST) Mentions(ctx context.Context, userID int, page Page) ([]models.MentionItem, error) {
+	var rows []models.Mention
+	qb := s.client.From("mentions").Select("*", "", false).Eq("user_id", strconv.Itoa(userID))
+	qb = paginateBy(qb, page, "created_at", "id")
+	if _, err := qb.ExecuteTo(&rows); err != nil {
+		return nil, err
+	}
+	tweetIDs, commentIDs := mentionTargetIDs(rows)
+	tweets, comments, err := s.tweetsAndComments(tweetIDs, commentIDs)
+	if err != nil {
+		return nil, err
+	}
+	return assembleMentions(rows, tweets, comments), nil
+}
+
+func (s *PostgREST) Interactors(ctx context.Context, target Target, kind Interaction, page Page) ([]models.InteractionEntry, error) {
+	var at string
+	switch kind {
+	case Like:
+		at = "liked_at"
+	case Restack:
+		at = "restacked_at"
+	default:
+		return nil, fmt.Errorf("unsupported interaction %q", kind)
+	}
+	table := "tweets"
+	if target.IsComment {
+		table = "comments"
+	}
+	if err := s.exists(table, target.ID); err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		At   time.Time   `json:"at"`
+		User models.User `json:"user"`
+	}
+	qb := s.client.From("user_tweet_interactions").Select("at:"+at+",user:users(*)", "", false)
+	if target.IsComment {
+		qb = qb.Eq("comment_id", strconv.Itoa(target.ID))
+	} else {
+		qb = qb.Eq("tweet_id", strconv.Itoa(target.ID)).Is("comment_id", "null")
+	}
+	qb = qb.Is(string(kind), "true")
+	qb = paginateBy(qb, page, at, "user_id")
+	if _, err := qb.ExecuteTo(&rows); err != nil {
+		return nil, err
+	}
+	entries := make([]models.InteractionEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, models.InteractionEntry{User: row.User, InteractedAt: row.At})
+	}
+	return entries, nil
+}
+
+// ownFolder returns ErrNotFound unless userID owns the bookmark folder.
+func (s *PostgREST) ownFolder(userID, folderID int) error {
+	var found []struct {
+		ID int `json:"id"`
+	}
+	qb := s.client.From("bookmark_folders").Select("id", "", false)
+	qb = qb.Eq("id", strconv.Itoa(folderID)).Eq("user_id", strconv.Itoa(userID))
+	if _, err := qb.ExecuteTo(&found); err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgREST) SavedTweets(ctx context.Context, userID int, folderID *int, page Page) ([]models.SavedTweet, error) {
+	if folderID != nil {
+		if err := s.ownFolder(userID, *folderID); err != nil {
+			return nil, err
+		}
+	}
+	var rows []struct {
+		SavedAt  time.Time            `json:"saved_at"`
+		FolderID *int                 `json:"folder_id"`
+		Tweet    models.TweetWithUser `json:"tweet"`
+	}
+	qb := s.client.From("user_tweet_interactions").Select("saved_at,folder_id,tweet:tweets(*,users(*))", "", false)
+	qb = qb.Eq("user_id", strconv.Itoa(userID)).Is("is_saved", "true").Is("comment_id", "null")
+	if folderID != nil {
+		qb = qb.Eq("folder_id", strconv.Itoa(*folderID))
+	}
+	qb = paginateBy(qb, page, "saved_at", "tweet_id")
+	if _, err := qb.ExecuteTo(&rows); err != nil {
+		return nil, err
+	}
+	saved := make([]models.SavedTweet, 0, len(rows))
+	for _, row := range rows {
+		saved = append(saved, models.SavedTweet{TweetWithUser: row.Tweet, SavedAt: row.SavedAt, FolderID: row.FolderID})
+	}
+	return saved, nil
+}
+
+func (s *PostgREST) BookmarkFolders(ctx context.Context, userID int) ([]models.BookmarkFolder, error) {
+	folders := make([]models.BookmarkFolder, 0)
+	qb := s.client.From("bookmark_folders").Select("*", "", false)
+	qb = qb.Eq("user_id", strconv.Itoa(userID))
+	qb = qb.Order("name", &postgrest.OrderOpts{Ascending: true}).Order("id", &postgrest.OrderOpts{Ascending: true})
+	if _, err := qb.ExecuteTo(&folders); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+func (s *PostgREST) CreateBookmarkFolder(ctx context.Context, userID int, name string) (models.BookmarkFolder, error) {
+	var folder models.BookmarkFolder
+	qb := s.client.From("bookmark_folders").Insert(map[string]interface{}{
+		"user_id": userID,
+		"name":    name,
+	}, false, "", "", "")
+	data, _, err := qb.Single().Execute()
+	if err != nil {
+		return folder, translateError(err)
+	}
+	err = json.Unmarshal(data, &folder)
+	return folder, err
+}
+
+func (s *PostgREST) DeleteBookmarkFolder(ctx context.Context, userID, folderID int) error {
+	return s.remove("bookmark_folders", userID, folderID)
+}
+
+func (s *PostgREST) FileSave(ctx context.Context, userID, tweetID int, folderID *int) error {
+	if folderID != nil {
+		if err := s.ownFolder(userID, *folderID); err != nil {
+			return err
+		}
+	}
+	qb := s.client.From("user_tweet_interactions").Update(map[string]interface{}{"folder_id": folderID}, "representation", "")
+	qb = qb.Eq("user_id", strconv.Itoa(userID)).Eq("tweet_id", strconv.Itoa(tweetID))
+	qb = qb.Is("comment_id", "null").Is("is_saved", "true")
+	data, _, err := qb.Execute()
+	if err != nil {
+		return err
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgREST) Follow(ctx context.Context, userID, followID int) error {
+	payload := map[string]interface{}{
+		"user_id":           userID,
+		"following_user_id": followID,
+	}
+	qb := s.client.From("user_following").Insert(payload, true, "user_id,following_user_id", "", "")
+	_, _, err := qb.Execute()
+	return translateError(err)
+}
+
+func (s *PostgREST) Unfollow(ctx context.Context, userID, followID int) error {
+	qb := s.client.From("user_following").Delete("", "")
+	qb = qb.Eq("user_id", strconv.Itoa(userID)).Eq("following_user_id", strconv.Itoa(followID))
+	_, _, err := qb.Execute()
+	return err
+}
+
+// followEntries lists one side of the follow graph: the users in userColumn
+// of the rows whose matchColumn is userID.
+func (s *PostgREST) followEntries(userID int, page Page, matchColumn, userColumn string) ([]models.FollowEntry, error) {
+	var rows []struct {
+		CreatedAt time.Time   `json:"created_at"`
+		User      models.User `json:"user"`
+	}
+	qb := s.client.From("user_following").Select("created_at,user:users!user_following_"+userColumn+"_fkey(*)", "", false)
+	qb = qb.Eq(matchColumn, strconv.Itoa(userID))
+	qb = paginateBy(qb, page, "created_at", userColumn)
+	if _, err := qb.ExecuteTo(&rows); err != nil {
+		return nil, err
+	}
+	entries := make([]models.FollowEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, models.FollowEntry{User: row.User, FollowedAt: row.CreatedAt})
+	}
+	return entries, nil
+}
+
+func (s *PostgREST) Followers(ctx context.Context, userID int, page Page) ([]models.FollowEntry, error) {
+	return s.followEntries(userID, page, "following_user_id", "user_id")
+}
+
+func (s *PostgREST) Following(ctx context.Context, userID int, page Page) ([]models.FollowEntry, error) {
+	return s.followEntries(userID, page, "user_id", "following_user_id")
+}
+
+// searchIDs calls one of the search functions in sql/search.sql and returns
+// the ids it ranks, best first, read from idField.
+func (s *PostgREST) searchIDs(fn, idField string, args map[string]interface{}) ([]int, error) {
+	var rows []map[string]json.Number
+	if err := s.rpc(fn, args, &rows); err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(rows))
+	for _, row := range rows {
+		id, err := strconv.Atoi(row[idField].String())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// searchFilterArgs returns the arguments of search_tweets and
+// search_comments for q.
+func searchFilterArgs(q SearchQuery, limit, offset int) map[string]interface{} {
+	args := map[string]interface{}{
+		"search_text":   q.websearch(),
+		"from_username": nil,
+		"before_at":     nil,
+		"after_at":      nil,
+		"has_replies":   q.HasReplies,
+		"page_size":     limit,
+		"page_offset":   offset,
+	}
+	if q.From != "" {
+		args["from_username"] = q.From
+	}
+	if q.Before != nil {
+		args["before_at"] = q.Before.UTC().Format(time.RFC3339Nano)
+	}
+	if q.After != nil {
+		args["after_at"] = q.After.UTC().Format(time.RFC3339Nano)
+	}
+	return args
+}
+
+// inRankOrder returns the rows whose id is in ids, in the order of ids.
+func inRankOrder[T any](ids []int, rows []T, id func(T) int) []T {
+	byID := make(map[int]T, len(rows))
+	for _, row := range rows {
+		byID[id(row)] = row
+	}
+	out := make([]T, 0, len(ids))
+	for _, i := range ids {
+		if row, ok := byID[i]; ok {
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+func (s *PostgREST) SearchTweets(ctx context.Context, q SearchQuery, limit, offset int) ([]models.TweetWithUser, error) {
+	ids, err := s.searchIDs("search_tweets", "tweet_id", searchFilterArgs(q, limit, offset))
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []models.TweetWithUser{}, nil
+	}
+	var tweets []models.TweetWithUser
+	if _, err := s.client.From("tweets").Select("*,users(*)", "", false).In("id", idList(ids)).ExecuteTo(&tweets); err != nil {
+		return nil, err
+	}
+	return inRankOrder(ids, tweets, func(t models.TweetWithUser) int { return t.ID }), nil
+}
+
+func (s *PostgREST) SearchComments(ctx context.Context, q SearchQuery, limit, offset int) ([]models.CommentWithUser, error) {
+	ids, err := s.searchIDs("search_comments", "comment_id", searchFilterArgs(q, limit, offset))
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []models.CommentWithUser{}, nil
+	}
+	var comments []models.CommentWithUser
+	if _, err := s.client.From("comments").Select("*,users(*)", "", false).In("id", idList(ids)).ExecuteTo(&comments); err != nil {
+		return nil, err
+	}
+	return inRankOrder(ids, comments, func(c models.CommentWithUser) int { return c.ID }), nil
+}
+
+func (s *PostgREST) SearchUsers(ctx context.Context, q SearchQuery, limit, offset int) ([]models.User, error) {
+	if !q.HasText() || q.HasOperators() {
+		return []models.User{}, nil
+	}
+	ids, err := s.searchIDs("search_users", "user_id", map[string]interface{}{
+		"search_text": q.websearch(),
+		"page_size":   limit,
+		"page_offset": offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []models.User{}, nil
+	}
+	var users []models.User
+	if _, err := s.client.From("users").Select("*", "", false).In("id", idList(ids)).ExecuteTo(&users); err != nil {
+		return nil, err
+	}
+	return inRankOrder(ids, users, func(u models.User) int { return u.ID }), nil
+}
+
+func (s *PostgREST) ReconcileCounters(ctx context.Context) (int, error) {
+	var changed int
+	if err := s.rpc("reconcile_counters", nil, &changed); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+func (s *PostgREST) SessionUser(ctx context.Context, sessionToken string) (string, time.Time, error) {
+	var sessions []struct {
+		Expires time.Time `json:"expires"`
+		UserID  string    `json:"userId"`
+	}
+	qb := s.nextAuth.From("sessions").Select("expires,userId", "", false)
+	qb = qb.Eq("sessionToken", sessionToken)
+	if _, err := qb.ExecuteTo(&sessions); err != nil {
+		return "", time.Time{}, err
+	}
+	if len(sessions) == 0 || sessions[0].UserID == "" {
+		return "", time.Time{}, ErrNotFound
+	}
+	return sessions[0].UserID, sessions[0].Expires, nil
+}
+
+func (s *PostgREST) UserIDForAuthUser(ctx context.Context, authUserID string) (int, error) {
+	var rows []struct {
+		UserID int `json:"user_id"`
+	}
+	qb := s.client.From("user_auth_map").Select("user_id", "", false)
+	qb = qb.Eq("auth_user_id", authUserID)
+	if _, err := qb.ExecuteTo(&rows); err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, ErrNotFound
+	}
+	return rows[0].UserID, nil
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SearchQuery is a parsed search. Text matches need every term and phrase;
+// the operators only narrow tweet and comment results.
+type SearchQuery struct {
+	Terms   []string
+	Phrases []string
+	// From keeps results written by the user with this username.
+	From string
+	// Before and After keep results created before Before and on or after
+	// After.
+	Before *time.Time
+	After  *time.Time
+	// HasReplies keeps tweets with at least one comment and comments with at
+	// least one reply.
+	HasReplies bool
+}
+
+// ErrEmptySearch is returned by ParseSearchQuery for a query with no terms,
+// phrases or operators.
+var ErrEmptySearch = errors.New("empty search query")
+
+const searchDateLayout = "2006-01-02"
+
+// ParseSearchQuery parses a search box query. Words are terms and "quoted
+// text" is a phrase; the operators are from:username, before:YYYY-MM-DD,
+// after:YYYY-MM-DD and has:replies. An unterminated quote runs to the end of
+// the query.
+func ParseSearchQuery(s string) (SearchQuery, error) {
+	var q SearchQuery
+	for s != "" {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			break
+		}
+		if s[0] == '"' {
+			phrase, rest, _ := strings.Cut(s[1:], `"`)
+			s = rest
+			if words := searchTokens(phrase); len(words) > 0 {
+				q.Phrases = append(q.Phrases, strings.Join(words, " "))
+			}
+			continue
+		}
+		end := strings.IndexFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+		if end < 0 {
+			end = len(s)
+		}
+		word := s[:end]
+		s = s[end:]
+
+		key, value, ok := strings.Cut(word, ":")
+		if ok && value != "" {
+			switch strings.ToLower(key) {
+			case "from":
+				q.From = strings.TrimPrefix(value, "@")
+				continue
+			case "before", "after":
+				day, err := time.Parse(searchDateLayout, value)
+				if err != nil {
+					return q, fmt.Errorf("%s: want a YYYY-MM-DD date, got %q", key, value)
+				}
+				if strings.ToLower(key) == "before" {
+					q.Before = &day
+				} else {
+					q.After = &day
+				}
+				continue
+			case "has":
+				if strings.ToLower(value) != "replies" {
+					return q, fmt.Errorf("has: unsupported value %q", value)
+				}
+				q.HasReplies = true
+				continue
+			}
+		}
+		q.Terms = append(q.Terms, searchTokens(word)...)
+	}
+	if !q.HasText() && !q.HasOperators() {
+		return q, ErrEmptySearch
+	}
+	return q, nil
+}
+
+// HasText reports whether q has terms or phrases.
+func (q SearchQuery) HasText() bool {
+	return len(q.Terms) > 0 || len(q.Phrases) > 0
+}
+
+// HasOperators reports whether q narrows results by author, date or replies.
+// Users are only searched by text, so such queries match no users.
+func (q SearchQuery) HasOperators() bool {
+	return q.From != "" || q.Before != nil || q.After != nil || q.HasReplies
+}
+
+// websearch renders the text of q for websearch_to_tsquery. Every term is
+// quoted so words such as "or" and "-x" keep no special meaning.
+func (q SearchQuery) websearch() string {
+	parts := make([]string, 0, len(q.Terms)+len(q.Phrases))
+	for _, t := range q.Terms {
+		parts = append(parts, `"`+t+`"`)
+	}
+	for _, p := range q.Phrases {
+		parts = append(parts, `"`+p+`"`)
+	}
+	return strings.Join(parts, " ")
+}
+
+// searchTokens lowercases s and splits it into words, like the default text
+// search parser.
+func searchTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// searchRank scores text against the text of q: zero when a term or phrase
+// is missing, and otherwise the number of matching words. It stands in for
+// ts_rank_cd in the in-memory store, without stemming or stop words.
+func searchRank(q SearchQuery, text string) int {
+	words := searchTokens(text)
+	rank := 0
+	for _, term := range q.Terms {
+		n := 0
+		for _, w := range words {
+			if w == term {
+				n++
+			}
+		}
+		if n == 0 {
+			return 0
+		}
+		rank += n
+	}
+	for _, phrase := range q.Phrases {
+		want := strings.Fields(phrase)
+		n := 0
+		for i := 0; i+len(want) <= len(words); i++ {
+			if slices.Equal(words[i:i+len(want)], want) {
+				n++
+			}
+		}
+		if n == 0 {
+			return 0
+		}
+		rank += n * len(want)
+	}
+	return rank
+}
@@ -0,0 +1,329 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// seedRow is one row of an INSERT statement keyed by column name.
+type seedRow map[string]any
+
+// seedInsert is a parsed INSERT INTO ... VALUES statement.
+type seedInsert struct {
+	Table string
+	Rows  []seedRow
+}
+
+// parseSeedSQL extracts the INSERT statements from a fixture file such as
+// sql/tweets.sql. Other statements are skipped. Values may be integers,
+// single-quoted strings, NULL, TRUE/FALSE or NOW().
+func parseSeedSQL(src string) ([]seedInsert, error) {
+	var inserts []seedInsert
+	for _, stmt := range splitStatements(src) {
+		p := &seedParser{src: stmt}
+		if !p.keyword("INSERT") {
+			continue
+		}
+		ins, err := p.insert()
+		if err != nil {
+			return nil, err
+		}
+		inserts = append(inserts, ins)
+	}
+	return inserts, nil
+}
+
+// splitStatements splits src on semicolons outside of quotes, dropping
+// -- line comments.
+func splitStatements(src string) []string {
+	var stmts []string
+	var b strings.Builder
+	inString := false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case inString:
+			b.WriteByte(c)
+			if c == '\'' {
+				if i+1 < len(src) && src[i+1] == '\'' {
+					b.WriteByte('\'')
+					i++
+				} else {
+					inString = false
+				}
+			}
+		case c == '\'':
+			inString = true
+			b.WriteByte(c)
+		case c == '-' && i+1 < len(src) && src[i+1] == '-':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			b.WriteByte('\n')
+		case c == ';':
+			stmts = append(stmts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if strings.TrimSpace(b.String()) != "" {
+		stmts = append(stmts, b.String())
+	}
+	return stmts
+}
+
+type seedParser struct {
+	src string
+	pos int
+}
+
+func (p *seedParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *seedParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("seed sql: "+format+" near %q", append(args, p.rest())...)
+}
+
+func (p *seedParser) rest() string {
+	r := p.src[p.pos:]
+	if len(r) > 30 {
+		r = r[:30]
+	}
+	return r
+}
+
+// keyword consumes kw case-insensitively if it is next.
+func (p *seedParser) keyword(kw string) bool {
+	p.skipSpace()
+	end := p.pos + len(kw)
+	if end > len(p.src) || !strings.EqualFold(p.src[p.pos:end], kw) {
+		return false
+	}
+	if end < len(p.src) && isIdentByte(p.src[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *seedParser) punct(c byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// ident reads a possibly schema-qualified, possibly double-quoted identifier.
+func (p *seedParser) ident() (string, error) {
+	p.skipSpace()
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			end := strings.IndexByte(p.src[p.pos+1:], '"')
+			if end < 0 {
+				return "", p.errorf("unterminated identifier")
+			}
+			b.WriteString(p.src[p.pos+1 : p.pos+1+end])
+			p.pos += end + 2
+		case isIdentByte(c):
+			b.WriteByte(c)
+			p.pos++
+		default:
+			if b.Len() == 0 {
+				return "", p.errorf("expected identifier")
+			}
+			return b.String(), nil
+		}
+	}
+	if b.Len() == 0 {
+		return "", p.errorf("expected identifier")
+	}
+	return b.String(), nil
+}
+
+func (p *seedParser) insert() (seedInsert, error) {
+	var ins seedInsert
+	if !p.keyword("INTO") {
+		return ins, p.errorf("expected INTO")
+	}
+	table, err := p.ident()
+	if err != nil {
+		return ins, err
+	}
+	ins.Table = strings.TrimPrefix(table, "public.")
+
+	if !p.punct('(') {
+		return ins, p.errorf("expected column list")
+	}
+	var cols []string
+	for {
+		col, err := p.ident()
+		if err != nil {
+			return ins, err
+		}
+		cols = append(cols, col)
+		if p.punct(')') {
+			break
+		}
+		if !p.punct(',') {
+			return ins, p.errorf("expected , or )")
+		}
+	}
+
+	if !p.keyword("VALUES") {
+		return ins, p.errorf("expected VALUES")
+	}
+	for {
+		if !p.punct('(') {
+			return ins, p.errorf("expected (")
+		}
+		row := seedRow{}
+		for i := range cols {
+			v, err := p.value()
+			if err != nil {
+				return ins, err
+			}
+			row[cols[i]] = v
+			if i < len(cols)-1 && !p.punct(',') {
+				return ins, p.errorf("expected ,")
+			}
+		}
+		if !p.punct(')') {
+			return ins, p.errorf("expected ) after %d values", len(cols))
+		}
+		ins.Rows = append(ins.Rows, row)
+		if !p.punct(',') {
+			break
+		}
+	}
+	p.skipSpace()
+	if p.pos != len(p.src) {
+		return ins, p.errorf("unexpected trailing input")
+	}
+	return ins, nil
+}
+
+// value reads a literal. Strings come back as string, integers as int,
+// NULL as nil, booleans as bool and NOW() as the current time.
+func (p *seedParser) value() (any, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("expected value")
+	}
+	if p.src[p.pos] == '\'' {
+		var b strings.Builder
+		for p.pos++; p.pos < len(p.src); p.pos++ {
+			c := p.src[p.pos]
+			if c != '\'' {
+				b.WriteByte(c)
+				continue
+			}
+			if p.pos+1 < len(p.src) && p.src[p.pos+1] == '\'' {
+				b.WriteByte('\'')
+				p.pos++
+				continue
+			}
+			p.pos++
+			return b.String(), nil
+		}
+		return nil, p.errorf("unterminated string")
+	}
+	switch {
+	case p.keyword("NULL"):
+		return nil, nil
+	case p.keyword("TRUE"):
+		return true, nil
+	case p.keyword("FALSE"):
+		return false, nil
+	case p.keyword("NOW"):
+		if !p.punct('(') || !p.punct(')') {
+			return nil, p.errorf("expected NOW()")
+		}
+		return time.Now().UTC(), nil
+	}
+	start := p.pos
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+	}
+	n, err := strconv.Atoi(p.src[start:p.pos])
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("unsupported value")
+	}
+	return n, nil
+}
+
+var seedTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05-07",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// seedTime converts a string or NOW() value to a time. Timestamps without a
+// zone are read as UTC.
+func seedTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		for _, layout := range seedTimeLayouts {
+			if ts, err := time.Parse(layout, t); err == nil {
+				return ts.UTC(), nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("seed sql: invalid timestamp %q", t)
+	case nil:
+		return time.Time{}, nil
+	}
+	return time.Time{}, fmt.Errorf("seed sql: invalid timestamp %v", v)
+}
+
+func seedInt(v any) (int, error) {
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("seed sql: invalid integer %v", v)
+}
+
+func seedString(v any) (string, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("seed sql: invalid text %v", v)
+}
+
+func seedBool(v any) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("seed sql: invalid boolean %v", v)
+}
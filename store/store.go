@@ -0,0 +1,279 @@
+// Package store defines the data layer used by the HTTP handlers and its
+// backends.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/et-hicks/imitation-backend/models"
+)
+
+// ErrNotFound is returned when a requested row does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrForbidden is returned when a user changes a row they do not own.
+var ErrForbidden = errors.New("forbidden")
+
+// ErrConflict is returned when a write collides with an existing row.
+var ErrConflict = errors.New("conflict")
+
+// Store is the full set of operations the handlers need.
+type Store interface {
+	TweetStore
+	CommentStore
+	UserStore
+	EditStore
+	InteractionStore
+	BookmarkStore
+	FollowStore
+	SearchStore
+	MentionStore
+	NotificationStore
+	AuthStore
+	CounterStore
+}
+
+// Cursor is a keyset position in a newest-first listing. Feeds, which can
+// hold a tweet once for its post and once per restack, also key on
+// RestackedBy: the restacking user's id, or 0 for the post.
+type Cursor struct {
+	CreatedAt   time.Time
+	ID          int
+	RestackedBy int
+}
+
+// Page selects a window of a listing ordered by (created_at, id) descending.
+type Page struct {
+	Limit int
+	// Before, when set, restricts the page to rows strictly older than it.
+	Before *Cursor
+}
+
+// TweetStore reads and writes tweets.
+type TweetStore interface {
+	// LatestTweets returns a page of the newest tweets across all users.
+	LatestTweets(ctx context.Context, page Page) ([]models.TweetWithUser, error)
+	// UserFeed returns a page of a user's profile feed: the tweets they wrote
+	// and the tweets they restacked, keyed like FollowingTimeline.
+	UserFeed(ctx context.Context, userID int, page Page) ([]models.FeedItem, error)
+	// GetTweet returns a single tweet or ErrNotFound.
+	GetTweet(ctx context.Context, tweetID int) (models.TweetWithUser, error)
+	// CreateTweet inserts a tweet and returns the stored row.
+	CreateTweet(ctx context.Context, userID int, body string) (models.Tweet, error)
+	// DeleteTweet deletes a tweet written by userID along with its comments,
+	// interactions and edit history. It returns ErrNotFound for a missing
+	// tweet and ErrForbidden when userID is not the author.
+	DeleteTweet(ctx context.Context, userID, tweetID int) error
+	// HashtagTweets returns a page of the newest tweets tagged with tag, which
+	// is lowercase and without its "#".
+	HashtagTweets(ctx context.Context, tag string, page Page) ([]models.TweetWithUser, error)
+	// FollowingTimeline returns a page of the tweets written or restacked by
+	// viewerID and the users they follow. A tweet appears once for its post
+	// and once for each restack, and the page is keyed by (FeedAt, tweet id,
+	// restacking user id).
+	FollowingTimeline(ctx context.Context, viewerID int, page Page) ([]models.FeedItem, error)
+}
+
+// CommentStore reads and writes comments.
+type CommentStore interface {
+	// TweetComments returns a page of the top-level comments on a tweet,
+	// newest first.
+	TweetComments(ctx context.Context, tweetID int, page Page) ([]models.CommentWithUser, error)
+	// CreateComment inserts a top-level comment on a tweet and returns the
+	// stored row. The tweet's comments and replies counters are incremented.
+	CreateComment(ctx context.Context, userID, tweetID int, body string) (models.Comment, error)
+	// CreateReply inserts a reply to a comment on the same tweet, or returns
+	// ErrNotFound when the parent is missing. The tweet's comments counter and
+	// the parent's replies counter are incremented.
+	CreateReply(ctx context.Context, userID, parentCommentID int, body string) (models.Comment, error)
+	// CommentThread returns a comment with its replies nested up to depth
+	// levels below it, or ErrNotFound.
+	CommentThread(ctx context.Context, commentID, depth int) (models.CommentThread, error)
+	// DeleteComment deletes a comment written by userID along with its
+	// replies, interactions and edit history, decrementing the counters of
+	// the tweet and parent comment. It
+	// returns ErrNotFound or ErrForbidden like DeleteTweet.
+	DeleteComment(ctx context.Context, userID, commentID int) error
+}
+
+// EditStore edits tweets and comments and keeps their prior versions.
+type EditStore interface {
+	// EditTweet replaces the body of a tweet written by editorID, marks it
+	// edited and records the prior body. It returns ErrNotFound for a missing
+	// tweet and ErrForbidden when editorID is not the author.
+	EditTweet(ctx context.Context, editorID, tweetID int, body string) (models.Tweet, error)
+	// EditComment is EditTweet for comments.
+	EditComment(ctx context.Context, editorID, commentID int, body string) (models.Comment, error)
+	// History returns a page of the prior versions of a tweet or comment,
+	// most recently replaced first, or ErrNotFound when it does not exist.
+	History(ctx context.Context, target Target, page Page) ([]models.Revision, error)
+}
+
+// UserStore reads and writes user profiles.
+type UserStore interface {
+	// GetUser returns a single user or ErrNotFound.
+	GetUser(ctx context.Context, userID int) (models.User, error)
+	// GetProfile returns a user with their follower and following counts, or
+	// ErrNotFound.
+	GetProfile(ctx context.Context, userID int) (models.Profile, error)
+	// UpdateBio replaces a user's bio.
+	UpdateBio(ctx context.Context, userID int, bio string) error
+	// UsersByUsername looks up users by lowercased username, matching
+	// usernames case-insensitively. The result is keyed by the lowercased
+	// username; unknown usernames are absent from it.
+	UsersByUsername(ctx context.Context, usernames []string) (map[string]models.User, error)
+}
+
+// MentionStore lists the tweets and comments that mention a user. Mentions
+// are recorded as tweets and comments are written and edited.
+type MentionStore interface {
+	// Mentions returns a page of the tweets and comments that mention userID,
+	// most recently mentioned first, keyed by (MentionedAt, mention id).
+	Mentions(ctx context.Context, userID int, page Page) ([]models.MentionItem, error)
+}
+
+// NotificationStore reads the notifications recorded as users like, restack,
+// reply to, follow and mention one another. Undoing a like, restack, follow
+// or mention takes its actor back out of the notification.
+type NotificationStore interface {
+	// Notifications returns a page of userID's notifications, most recently
+	// updated first, keyed by (UpdatedAt, notification id).
+	Notifications(ctx context.Context, userID int, page Page) ([]models.Notification, error)
+	// UnreadNotifications counts userID's unread notifications.
+	UnreadNotifications(ctx context.Context, userID int) (int, error)
+	// MarkNotificationsRead marks the listed notifications of userID read, or
+	// all of them when ids is nil. Ids of other users' notifications are
+	// ignored.
+	MarkNotificationsRead(ctx context.Context, userID int, ids []int) error
+}
+
+// Interaction names a per-user flag stored in user_tweet_interactions.
+type Interaction string
+
+const (
+	Like    Interaction = "is_liked"
+	Save    Interaction = "is_saved"
+	Restack Interaction = "is_restacked"
+)
+
+// Target identifies the tweet or comment an interaction applies to.
+type Target struct {
+	ID        int
+	IsComment bool
+}
+
+// splitTargets separates the tweet and comment ids of targets.
+func splitTargets(targets []Target) (tweetIDs, commentIDs []int) {
+	for _, t := range targets {
+		if t.IsComment {
+			commentIDs = append(commentIDs, t.ID)
+		} else {
+			tweetIDs = append(tweetIDs, t.ID)
+		}
+	}
+	return tweetIDs, commentIDs
+}
+
+// viewerState reads the flags of an interaction row.
+func viewerState(row models.UserTweetInteraction) models.ViewerState {
+	return models.ViewerState{Liked: row.IsLiked, Saved: row.IsSaved, Restacked: row.IsRestacked}
+}
+
+// interactionTarget returns the tweet or comment an interaction row applies to.
+func interactionTarget(row models.UserTweetInteraction) (Target, bool) {
+	switch {
+	case row.CommentID != nil:
+		return Target{ID: *row.CommentID, IsComment: true}, true
+	case row.TweetID != nil:
+		return Target{ID: *row.TweetID}, true
+	}
+	return Target{}, false
+}
+
+// InteractionStore records likes, saves and restacks.
+type InteractionStore interface {
+	// SetInteraction turns an interaction flag on or off for a user and target
+	// and reports whether the flag flipped. The target's likes, saves or
+	// restacks counter changes only when it did.
+	SetInteraction(ctx context.Context, userID int, target Target, kind Interaction, active bool) (bool, error)
+	// ViewerStates looks up userID's interactions with every target at once.
+	// Targets the user never interacted with are absent from the result.
+	ViewerStates(ctx context.Context, userID int, targets []Target) (map[Target]models.ViewerState, error)
+	// LikedItems returns a page of the tweets and comments userID liked, most
+	// recently liked first, keyed by (LikedAt, like id).
+	LikedItems(ctx context.Context, userID int, page Page) ([]models.LikedItem, error)
+	// Interactors returns a page of the users who liked or restacked the
+	// target, most recent first, keyed by (InteractedAt, user id). kind must
+	// be Like or Restack; saves are private. It returns ErrNotFound when the
+	// target does not exist.
+	Interactors(ctx context.Context, target Target, kind Interaction, page Page) ([]models.InteractionEntry, error)
+}
+
+// BookmarkStore lists saved tweets and files them into folders.
+type BookmarkStore interface {
+	// SavedTweets returns a page of the tweets userID saved, most recently
+	// saved first, keyed by (SavedAt, tweet id). When folderID is set only the
+	// tweets filed in that folder are listed, and ErrNotFound is returned
+	// unless userID owns the folder.
+	SavedTweets(ctx context.Context, userID int, folderID *int, page Page) ([]models.SavedTweet, error)
+	// BookmarkFolders returns userID's folders ordered by name.
+	BookmarkFolders(ctx context.Context, userID int) ([]models.BookmarkFolder, error)
+	// CreateBookmarkFolder adds a folder for userID, or returns ErrConflict
+	// when they already have one with that name.
+	CreateBookmarkFolder(ctx context.Context, userID int, name string) (models.BookmarkFolder, error)
+	// DeleteBookmarkFolder deletes a folder owned by userID. The tweets filed
+	// in it stay saved, unfiled. It returns ErrNotFound for a missing folder
+	// and ErrForbidden when userID does not own it.
+	DeleteBookmarkFolder(ctx context.Context, userID, folderID int) error
+	// FileSave moves a tweet userID saved into folderID, or out of any folder
+	// when folderID is nil. It returns ErrNotFound when the tweet is not saved
+	// or userID does not own the folder. Undoing a save also unfiles it.
+	FileSave(ctx context.Context, userID, tweetID int, folderID *int) error
+}
+
+// FollowStore records the follow graph.
+type FollowStore interface {
+	// Follow records that userID follows followID.
+	Follow(ctx context.Context, userID, followID int) error
+	// Unfollow removes the follow from userID to followID, if any.
+	Unfollow(ctx context.Context, userID, followID int) error
+	// Followers returns a page of the users following userID, most recent
+	// follow first, keyed by (FollowedAt, user id).
+	Followers(ctx context.Context, userID int, page Page) ([]models.FollowEntry, error)
+	// Following returns a page of the users userID follows, most recent
+	// follow first, keyed by (FollowedAt, user id).
+	Following(ctx context.Context, userID int, page Page) ([]models.FollowEntry, error)
+}
+
+// SearchStore runs full-text searches parsed by ParseSearchQuery. Results are
+// ranked best match first and then newest first; offset skips that many.
+type SearchStore interface {
+	// SearchTweets returns the tweets matching q.
+	SearchTweets(ctx context.Context, q SearchQuery, limit, offset int) ([]models.TweetWithUser, error)
+	// SearchComments returns the comments matching q.
+	SearchComments(ctx context.Context, q SearchQuery, limit, offset int) ([]models.CommentWithUser, error)
+	// SearchUsers returns the users whose username, profile name or bio match
+	// the text of q. Queries with operators match no users.
+	SearchUsers(ctx context.Context, q SearchQuery, limit, offset int) ([]models.User, error)
+}
+
+// CounterStore maintains the denormalized counters on tweets and comments.
+// The database backends keep them current with the triggers in
+// sql/counters.sql.
+type CounterStore interface {
+	// ReconcileCounters recomputes every tweet and comment counter from
+	// user_tweet_interactions and comments, returning how many rows changed.
+	ReconcileCounters(ctx context.Context) (int, error)
+}
+
+// AuthStore resolves Auth.js identities to public users.
+type AuthStore interface {
+	// SessionUser returns the next_auth.users id and expiry of a session token,
+	// or ErrNotFound.
+	SessionUser(ctx context.Context, sessionToken string) (authUserID string, expires time.Time, err error)
+	// UserIDForAuthUser resolves a next_auth.users id through user_auth_map, or
+	// returns ErrNotFound.
+	UserIDForAuthUser(ctx context.Context, authUserID string) (int, error)
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"sort"
+
+	"github.com/et-hicks/imitation-backend/models"
+)
+
+// assembleThread nests the replies among rows beneath root, oldest first,
+// down to depth levels. rows may hold comments outside the thread.
+func assembleThread(root models.CommentWithUser, rows []models.CommentWithUser, depth int) models.CommentThread {
+	children := map[int][]models.CommentWithUser{}
+	for _, c := range rows {
+		if c.ParentCommentID != nil {
+			children[*c.ParentCommentID] = append(children[*c.ParentCommentID], c)
+		}
+	}
+	var build func(c models.CommentWithUser, depth int) models.CommentThread
+	build = func(c models.CommentWithUser, depth int) models.CommentThread {
+		node := models.CommentThread{CommentWithUser: c, Children: []models.CommentThread{}}
+		if depth == 0 {
+			return node
+		}
+		replies := children[c.ID]
+		sort.Slice(replies, func(i, j int) bool {
+			return newestFirst(replies[j].CreatedAt, replies[j].ID, replies[i].CreatedAt, replies[i].ID)
+		})
+		for _, r := range replies {
+			node.Children = append(node.Children, build(r, depth-1))
+		}
+		return node
+	}
+	return build(root, depth)
+}